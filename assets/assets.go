@@ -0,0 +1,11 @@
+// Package assets embeds the static files (stylesheets, fonts, and icons) used
+// by the Tonic page templates so that services don't depend on an assets
+// directory at runtime.
+package assets
+
+import "embed"
+
+// FS contains the static files served under /assets/.
+//
+//go:embed *.css *.png *.ttf font-awesome-4.6.3 octicons-4.3.0
+var FS embed.FS
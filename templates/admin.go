@@ -0,0 +1,162 @@
+package templates
+
+// Admin page template for service administrators.
+const Admin = `
+{{define "content"}}
+	<div class="repository file list">
+		<div class="ui container">
+			<h3 class="ui top attached header">{{T "Service status"}}: {{if .readiness.Ready}}{{T "Ready"}}{{else}}{{T "Not ready"}}{{end}}</h3>
+			<table class="ui attached unstackable fixed single line table">
+				<tbody>
+					{{range $check := .readiness.Checks}}
+						<tr>
+							<td class="name text bold four wide">{{$check.Name}}</td>
+							<td class="name text two wide">{{if $check.OK}}{{T "OK"}}{{else}}{{T "Failed"}}{{end}}</td>
+							<td class="name text ten wide">{{$check.Message}}</td>
+						</tr>
+					{{end}}
+				</tbody>
+			</table>
+
+			<h3 class="ui attached header">{{T "Scheduled jobs"}}</h3>
+			<table class="ui attached unstackable fixed single line table">
+				<thead>
+					<tr>
+						<th class="four wide">{{T "Name"}}</th>
+						<th class="three wide">{{T "Schedule"}}</th>
+						<th class="three wide">{{T "Action"}}</th>
+						<th class="three wide">{{T "Previous run"}}</th>
+						<th class="three wide">{{T "Next run"}}</th>
+					</tr>
+				</thead>
+				<tbody>
+					{{range $sched := .schedules}}
+						<tr>
+							<td class="name text bold">{{$sched.Name}}</td>
+							<td class="name text"><code>{{$sched.Spec}}</code></td>
+							<td class="name text">{{if $sched.Default}}{{T "Service action"}}{{else}}{{T "Custom action"}}{{end}}</td>
+							<td class="name text">{{formatTime $sched.Prev}}</td>
+							<td class="name text">{{formatTime $sched.Next}}</td>
+						</tr>
+					{{else}}
+						<tr><td colspan="5">{{T "No scheduled jobs"}}</td></tr>
+					{{end}}
+				</tbody>
+			</table>
+
+			<h3 class="ui attached header">{{T "Recent scheduled runs"}}</h3>
+			<table class="ui attached unstackable fixed single line table">
+				<tbody>
+					{{range $job := .scheduled_runs}}
+						<tr>
+							<td class="name text bold two wide"><a href="{{url "/log/"}}{{$job.ID}}">{{T "Job %d" $job.ID}}</a></td>
+							<td class="name text bold four wide"><a href="{{url "/log/"}}{{$job.ID}}">{{$job.Label}}</a></td>
+							<td class="name text five wide">{{formatTime $job.SubmitTime}}</td>
+							<td class="name text five wide">{{formatTime $job.EndTime}}</td>
+							<td class="name text four wide">{{if $job.Error}}{{$job.Error}}{{end}}</td>
+						</tr>
+					{{else}}
+						<tr><td colspan="5">{{T "No scheduled runs"}}</td></tr>
+					{{end}}
+				</tbody>
+			</table>
+
+			<h3 class="ui attached header">{{T "Recent webhook events"}}</h3>
+			<table class="ui attached unstackable fixed single line table">
+				<tbody>
+					{{range $job := .event_runs}}
+						<tr>
+							<td class="name text bold two wide"><a href="{{url "/log/"}}{{$job.ID}}">{{T "Job %d" $job.ID}}</a></td>
+							<td class="name text bold four wide"><a href="{{url "/log/"}}{{$job.ID}}">{{$job.Label}}</a></td>
+							<td class="name text five wide">{{formatTime $job.SubmitTime}}</td>
+							<td class="name text five wide">{{formatTime $job.EndTime}}</td>
+							<td class="name text four wide">{{if $job.Error}}{{$job.Error}}{{end}}</td>
+						</tr>
+					{{else}}
+						<tr><td colspan="5">{{T "No webhook events"}}</td></tr>
+					{{end}}
+				</tbody>
+			</table>
+
+			<h3 class="ui attached header">{{T "Locked out logins"}}</h3>
+			<table class="ui attached unstackable fixed single line table">
+				<thead>
+					<tr>
+						<th class="three wide">{{T "Type"}}</th>
+						<th class="six wide">{{T "Address or username"}}</th>
+						<th class="two wide">{{T "Failures"}}</th>
+						<th class="five wide">{{T "Locked until"}}</th>
+					</tr>
+				</thead>
+				<tbody>
+					{{range $lockout := .lockouts}}
+						<tr>
+							<td class="name text">{{if eq $lockout.Kind "address"}}{{T "Address"}}{{else}}{{T "Username"}}{{end}}</td>
+							<td class="name text bold">{{$lockout.Value}}</td>
+							<td class="name text">{{$lockout.Failures}}</td>
+							<td class="name text">{{formatTime $lockout.Until}}</td>
+						</tr>
+					{{else}}
+						<tr><td colspan="4">{{T "No locked out logins"}}</td></tr>
+					{{end}}
+				</tbody>
+			</table>
+
+			<h3 class="ui attached header">{{T "Recent failed logins"}}</h3>
+			<table class="ui attached unstackable fixed single line table">
+				<thead>
+					<tr>
+						<th class="four wide">{{T "Time"}}</th>
+						<th class="four wide">{{T "Username"}}</th>
+						<th class="three wide">{{T "Address"}}</th>
+						<th class="five wide">{{T "Reason"}}</th>
+					</tr>
+				</thead>
+				<tbody>
+					{{range $login := .failed_logins}}
+						<tr>
+							<td class="name text">{{formatTime $login.Time}}</td>
+							<td class="name text bold">{{$login.Username}}</td>
+							<td class="name text">{{$login.Address}}</td>
+							<td class="name text">{{$login.Reason}}</td>
+						</tr>
+					{{else}}
+						<tr><td colspan="4">{{T "No failed logins"}}</td></tr>
+					{{end}}
+				</tbody>
+			</table>
+
+			<h3 class="ui attached header">{{T "Recent GIN API changes"}}</h3>
+			<table class="ui attached unstackable fixed single line table">
+				<thead>
+					<tr>
+						<th class="three wide">{{T "Time"}}</th>
+						<th class="two wide">{{T "User ID"}}</th>
+						<th class="two wide">{{T "Job"}}</th>
+						<th class="one wide">{{T "Account"}}</th>
+						<th class="five wide">{{T "Endpoint"}}</th>
+						<th class="three wide">{{T "Outcome"}}</th>
+					</tr>
+				</thead>
+				<tbody>
+					{{range $entry := .audit}}
+						<tr>
+							<td class="name text">{{formatTime $entry.Time}}</td>
+							<td class="name text">{{$entry.UserID}}</td>
+							<td class="name text">{{if $entry.JobID}}<a href="{{url "/log/"}}{{$entry.JobID}}">{{T "Job %d" $entry.JobID}}</a>{{end}}</td>
+							<td class="name text">{{if eq $entry.Actor "bot"}}{{T "Bot"}}{{else}}{{T "User"}}{{end}}</td>
+							<td class="name text"><code>{{$entry.Method}} {{$entry.Endpoint}}</code></td>
+							<td class="name text">{{if $entry.Status}}{{$entry.Status}} {{end}}{{$entry.Error}}</td>
+						</tr>
+					{{else}}
+						<tr><td colspan="6">{{T "No GIN API changes"}}</td></tr>
+					{{end}}
+				</tbody>
+			</table>
+			<div class="ui bottom attached segment">
+				{{T "Export audit log"}}: <a href="{{url "/admin/audit"}}">CSV</a> · <a href="{{url "/admin/audit"}}?format=json">JSON</a>
+			</div>
+		</div>
+	</div>
+{{end}}
+`
@@ -6,7 +6,7 @@ var Fail = `
 {{ define "content" }}
 
 <br><br>
-<h1>{{ .StatusCode }}: {{ .StatusText }}</h1>
+<h1>{{ .StatusCode }}: {{ T .StatusText }}</h1>
 <div style="color: red; font-weight: bold">
 {{ .Message }}
 </div>
@@ -6,8 +6,14 @@ const Form = `
 			<div class="ginform">
 				<div class="ui middle very relaxed page grid">
 					<div class="column">
-						<form class="ui form" action="/" method="post">
+						<form class="ui form" action="{{url (or .form_url "/")}}" method="post">
 							<input type="hidden" name="_csrf" value="">
+							{{if .submission_key}}
+								<input type="hidden" name="_submission" value="{{.submission_key}}">
+							{{end}}
+							{{if .parent_id}}
+								<input type="hidden" name="_parent" value="{{.parent_id}}">
+							{{end}}
 							<h3 class="ui top attached header">
 								{{.form.Name}}
 							</h3>
@@ -29,34 +35,78 @@ const Form = `
 								{{if not $readonly}}
 									<div class="inline field">
 										<label></label>
-										<button class="ui green button">Submit</button>
+										<button class="ui green button">{{T "Submit"}}</button>
 									</div>
 								{{end}}
 							</div>
 
 							{{if $readonly}}
-								<h3 class="ui attached header">Status</h3>
+								<h3 class="ui attached header">{{T "Status"}}</h3>
 								<div class="ui attached segment">
-									{{if not .end_time}}
+									{{if and (not .end_time) .attempts}}
+										<div class="ui warning message">
+											{{T "Job failed with a temporary error and is queued to be retried"}}
+										</div>
+									{{else if not .end_time}}
 										<div class="ui message">
-											Job is in queue
+											{{T "Job is in queue"}}
 										</div>
 									{{else if .error}}
 										<div class="ui negative message">
-											<b>Job failed with error:</b> {{.error}}
+											<b>{{T "Job failed with error:"}}</b> {{.error}}
 										</div>
 									{{else}}
 										<div class="ui positive message">
-											Job completed <b>successfully</b>
+											{{T "Job completed successfully"}}
 										</div>
 									{{end}}
 									<ul class="list">
-										<li><b>Submitted</b> {{.submit_time}}</li>
+										<li><b>{{T "Submitted"}}</b> {{formatTime .submit_time}}</li>
 										{{if .end_time}}
-											<li><b>Finished</b> {{.end_time}}</li>
+											<li><b>{{T "Finished"}}</b> {{formatTime .end_time}}</li>
+										{{end}}
+										<li><b>{{T "Fingerprint"}}</b> <code>{{.fingerprint}}</code></li>
+										{{if .trace_id}}
+											<li><b>{{T "Trace"}}</b> <code>{{.trace_id}}</code></li>
+										{{end}}
+										{{if .retry_chain}}
+											<li><b>{{T "Retry of"}}</b>
+												{{range $idx, $id := .retry_chain}}{{if $idx}} &rarr; {{end}}<a href="{{url "/log/"}}{{$id}}">{{T "Job %d" $id}}</a>{{end}}
+											</li>
+										{{end}}
+										{{if .retries}}
+											<li><b>{{T "Retried as"}}</b>
+												{{range $idx, $retry := .retries}}{{if $idx}}, {{end}}<a href="{{url "/log/"}}{{$retry.ID}}">{{T "Job %d" $retry.ID}}</a>{{end}}
+											</li>
 										{{end}}
 									</ul>
-								<h3 class="ui attached header">Job log</h3>
+									{{if .end_time}}
+										<div class="inline field">
+											{{if .error}}
+												<button class="ui green button" formaction="{{url "/log/"}}{{.job_id}}/retry" formmethod="post">{{T "Retry"}}</button>
+											{{end}}
+											<a class="ui button" href="{{url "/log/"}}{{.job_id}}/edit">{{T "Edit and resubmit"}}</a>
+										</div>
+									{{end}}
+								{{if .attempts}}
+								<h3 class="ui attached header">{{T "Attempts"}}</h3>
+									<ol class="list">
+									{{range $attempt := .attempts}}
+										<li>
+											{{formatTime $attempt.StartTime}}:
+											{{if $attempt.Error}}{{T "failed with error:"}} {{$attempt.Error}}{{else}}{{T "succeeded"}}{{end}}
+											{{if $attempt.Messages}}
+												<ul>
+												{{range $msg := $attempt.Messages}}
+													<li>{{$msg}}</li>
+												{{end}}
+												</ul>
+											{{end}}
+										</li>
+									{{end}}
+									</ol>
+								{{end}}
+								<h3 class="ui attached header">{{T "Job log"}}</h3>
 									<ol class="list" start="0">
 									{{range $msg := .messages}}
 										<li>{{$msg}}</li>
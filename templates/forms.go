@@ -0,0 +1,25 @@
+package templates
+
+// Forms template for listing the forms of a service with more than one form.
+const Forms = `
+{{define "content"}}
+	<div class="repository file list">
+		<div class="ui container">
+			<p id="repo-desc">
+			<span class="description has-emoji">{{T "Forms"}}</span>
+			</p>
+			<table id="repo-files-table" class="ui unstackable fixed single line table">
+				<tbody>
+					{{range $form := .}}
+						<tr>
+							<td class="name text bold four wide"><a href="{{url $form.URL}}">{{T $form.Title}}</a></td>
+							<td class="message collapsing has-emoji">{{T $form.Description}}</td>
+							<td class="text grey right age two wide"><a href="{{url "/log"}}?form={{$form.Name}}">{{T "Jobs"}}</a></td>
+						</tr>
+					{{end}}
+				</tbody>
+			</table>
+		</div>
+	</div>
+{{end}}
+`
@@ -3,24 +3,41 @@ package templates
 // TODO: Switch Login || Logout
 
 // Layout is the main site template. It includes the header and footer and
-// embeds the content for every other page.
+// embeds the content for every other page.  The branding is provided by the
+// "theme" template function.
 var Layout = `
 {{ define "layout" }}
-<html>
+{{ $theme := theme }}
+<html lang="{{lang.Language}}">
 	<!DOCTYPE html>
-	<head data-suburl="">
-		<link rel="shortcut icon" href="https://gindata.biologie.hu-berlin.de/img/favicon.png" />
-		<link rel="stylesheet" href="/assets/font-awesome-4.6.3/css/font-awesome.min.css">
-		<link rel="stylesheet" href="/assets/octicons-4.3.0/octicons.min.css">
-		<link rel="stylesheet" href="/assets/semantic-2.3.1.min.css">
-		<link rel="stylesheet" href="/assets/gogs.css">
-		<link rel="stylesheet" href="/assets/custom.css">
-		<title>TONIC Project administration</title>
+	<head data-suburl="{{url ""}}">
+		<link rel="shortcut icon" href="{{$theme.Favicon}}" />
+		<link rel="stylesheet" href="{{url "/assets/font-awesome-4.6.3/css/font-awesome.min.css"}}">
+		<link rel="stylesheet" href="{{url "/assets/octicons-4.3.0/octicons.min.css"}}">
+		<link rel="stylesheet" href="{{url "/assets/semantic-2.3.1.min.css"}}">
+		<link rel="stylesheet" href="{{url "/assets/gogs.css"}}">
+		<link rel="stylesheet" href="{{url "/assets/custom.css"}}">
+		{{with $theme.Colors}}
+		<style>
+			{{with .Primary}}
+			a, .ui .text.red, .ui .text.blue { color: {{.}} !important; }
+			.ui.green.button, .ui.primary.button { background-color: {{.}} !important; }
+			{{end}}
+			{{with .Header}}
+			.following.bar.light { background-color: {{.}} !important; }
+			{{end}}
+			{{with .Footer}}
+			footer { background-color: {{.}} !important; }
+			{{end}}
+		</style>
+		{{end}}
+		<title>{{T $theme.Title}}</title>
+		<meta name="description" content="{{T $theme.Description}}"/>
 		<meta name="twitter:card" content="summary" />
-		<meta name="twitter:site" content="@gnode" />
-		<meta name="twitter:title" content="GIN Valid"/>
-		<meta name="twitter:description" content="G-Node GIN Validation service"/>
-		<meta name="twitter:image" content="https://gindata.biologie.hu-berlin.de/img/favicon.png" />
+		{{with $theme.Twitter}}<meta name="twitter:site" content="{{.}}" />{{end}}
+		<meta name="twitter:title" content="{{T $theme.Title}}"/>
+		<meta name="twitter:description" content="{{T $theme.Description}}"/>
+		<meta name="twitter:image" content="{{$theme.Favicon}}" />
 	</head>
 	<body>
 		<div class="full height">
@@ -29,11 +46,11 @@ var Layout = `
 					<div class="ui grid">
 						<div class="column">
 							<div class="ui top secondary menu">
-								<a class="item brand" href="https://gindata.biologie.hu-berlin.de">
-									<img class="ui mini image" src="https://gindata.biologie.hu-berlin.de/img/favicon.png">
+								<a class="item brand" href="{{$theme.HomeURL}}">
+									<img class="ui mini image" src="{{$theme.Logo}}">
 								</a>
-								<a class="item" href="/">New</a>
-								<a class="item" href="/log">Jobs</a>
+								<a class="item" href="{{url "/"}}">{{T "New"}}</a>
+								<a class="item" href="{{url "/log"}}">{{T "Jobs"}}</a>
 							</div>
 						</div>
 					</div>
@@ -44,14 +61,17 @@ var Layout = `
 		<footer>
 			<div class="ui container">
 				<div class="ui center links item brand footertext">
-					<a href="https://gindata.biologie.hu-berlin.de"><img class="ui mini footericon" src="https://projects.g-node.org/assets/gnode-bootstrap-theme/1.2.0-snapshot/img/gnode-icon-50x50-transparent.png"/>© tonic team 2022</a>
-					<a href="https://gindata.biologie.hu-berlin.de/G-Node/Info/wiki/about">About</a>
-					<a href="https://gindata.biologie.hu-berlin.de/G-Node/Info/wiki/imprint">Imprint</a>
-					<a href="https://gindata.biologie.hu-berlin.de/G-Node/Info/wiki/contact">Contact</a>
-					<a href="https://gindata.biologie.hu-berlin.de/G-Node/Info/wiki/Terms+of+Use">Terms of Use</a>
-					<a href="https://gindata.biologie.hu-berlin.de/G-Node/Info/wiki/Datenschutz">Datenschutz</a>
+					<a href="{{$theme.HomeURL}}">{{with $theme.FooterLogo}}<img class="ui mini footericon" src="{{.}}"/>{{end}}{{T $theme.FooterText}}</a>
+					{{range $theme.Links}}
+					<a href="{{.URL}}">{{T .Name}}</a>
+					{{end}}
 				</div>
 				<div class="ui center links item brand footertext">
+					{{if gt (len languages) 1}}
+						{{range languages}}
+							<a href="?lang={{.Language}}">{{.Name}}</a>
+						{{end}}
+					{{end}}
 				</div>
 			</div>
 		</footer>
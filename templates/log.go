@@ -22,17 +22,17 @@ const LogView = `
 		</div>
 		<div class="ui container">
 			<p id="repo-desc">
-			<span class="description has-emoji">Work log</span>
+			<span class="description has-emoji">{{T "Work log"}}</span>
 			<a class="link" href=""></a>
 			</p>
 			<table id="repo-files-table" class="ui unstackable fixed single line table">
 				<tbody>
 					{{range $job := .}}
 						<tr>
-							<td class="name text bold two wide"><a href="/log/{{$job.ID}}">Job {{$job.ID}}</a></td>
-							<td class="name text bold four wide"><a href="/log/{{$job.ID}}">{{$job.Label}}</a></td>
-							<td class="name text five wide">{{$job.SubmitTime}}</td>
-							<td class="name text five wide">{{$job.EndTime}}</td>
+							<td class="name text bold two wide"><a href="{{url "/log/"}}{{$job.ID}}">{{T "Job %d" $job.ID}}</a></td>
+							<td class="name text bold four wide"><a href="{{url "/log/"}}{{$job.ID}}">{{$job.Label}}</a></td>
+							<td class="name text five wide">{{formatTime $job.SubmitTime}}</td>
+							<td class="name text five wide">{{formatTime $job.EndTime}}</td>
 							<td class="name text four wide">{{if $job.Error}}{{$job.Error}}{{end}}</td>
 						</tr>
 					{{end}}
@@ -8,23 +8,23 @@ const Login = `
 			<div class="user signin">
 				<div class="ui middle very relaxed page grid">
 					<div class="column">
-						<form class="ui form" action="/login" method="post">
+						<form class="ui form" action="{{url "/login"}}" method="post">
 							<input type="hidden" name="_csrf" value="">
 							<h3 class="ui top attached header">
-								Sign In using your GIN credentials
+								{{T "Sign In using your GIN credentials"}}
 							</h3>
 							<div class="ui attached segment">
 								<div class="required inline field ">
-									<label for="username">Username or email</label>
+									<label for="username">{{T "Username or email"}}</label>
 									<input id="username" name="username" value="" autofocus required>
 								</div>
 								<div class="required inline field ">
-									<label for="password">Password</label>
+									<label for="password">{{T "Password"}}</label>
 									<input id="password" name="password" type="password" autocomplete="off" value="" required>
 								</div>
 								<div class="inline field">
 									<label></label>
-									<button class="ui green button">Sign In</button>
+									<button class="ui green button">{{T "Sign In"}}</button>
 								</div>
 							</div>
 						</form>
@@ -0,0 +1,110 @@
+package tonic
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/G-Node/tonic/tonic/db"
+	"github.com/G-Node/tonic/tonic/worker"
+)
+
+// auditCSVHeader lists the columns of the CSV export of the audit log.
+var auditCSVHeader = []string{"id", "time", "user_id", "job_id", "actor", "method", "endpoint", "status", "error"}
+
+// auditTokenCreation records the access token that is created for a user who
+// logs in without one in the audit log.  The login uses its own GIN client,
+// so the change is not recorded by an audited worker.Client.
+func (srv *Tonic) auditTokenCreation(username string, userID int64, err error) {
+	entry := &db.AuditEntry{
+		Time:     time.Now(),
+		UserID:   userID,
+		Actor:    worker.AuditUser,
+		Method:   http.MethodPost,
+		Endpoint: fmt.Sprintf("/api/v1/users/%s/tokens", username),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Status = http.StatusCreated
+	}
+	if dberr := srv.db.InsertAuditEntry(entry); dberr != nil {
+		srv.log.Error("Failed to record API call in audit log", "method", entry.Method, "endpoint", entry.Endpoint, "error", dberr)
+	}
+}
+
+// csvCell returns the value of a cell of the CSV export.  Values that
+// spreadsheet applications would evaluate as a formula are prefixed with a
+// single quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// exportAudit writes the audit log as CSV, or as JSON lines if the "format"
+// query parameter is "json".  The "user" and "job" query parameters limit the
+// export to the entries of a user or job.
+func (srv *Tonic) exportAudit(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	query := r.URL.Query()
+	var userID, jobID int64
+	var err error
+	if user := query.Get("user"); user != "" {
+		if userID, err = strconv.ParseInt(user, 10, 64); err != nil {
+			srv.web.ErrorResponse(w, r, http.StatusBadRequest, "Invalid ID")
+			return
+		}
+	}
+	if job := query.Get("job"); job != "" {
+		if jobID, err = strconv.ParseInt(job, 10, 64); err != nil {
+			srv.web.ErrorResponse(w, r, http.StatusBadRequest, "Invalid ID")
+			return
+		}
+	}
+
+	var write func(entry *db.AuditEntry) error
+	var flush func() error
+	switch query.Get("format") {
+	case "json":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		encoder := json.NewEncoder(w)
+		write = func(entry *db.AuditEntry) error { return encoder.Encode(entry) }
+		flush = func() error { return nil }
+	default:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		csvw := csv.NewWriter(w)
+		csvw.Write(auditCSVHeader)
+		write = func(entry *db.AuditEntry) error {
+			return csvw.Write([]string{
+				strconv.FormatInt(entry.ID, 10),
+				entry.Time.UTC().Format(time.RFC3339),
+				strconv.FormatInt(entry.UserID, 10),
+				strconv.FormatInt(entry.JobID, 10),
+				csvCell(entry.Actor),
+				csvCell(entry.Method),
+				csvCell(entry.Endpoint),
+				strconv.Itoa(entry.Status),
+				csvCell(entry.Error),
+			})
+		}
+		flush = func() error {
+			csvw.Flush()
+			return csvw.Error()
+		}
+	}
+
+	// the response has started, so errors can only be logged
+	if err := srv.db.IterateAuditEntries(userID, jobID, write); err != nil {
+		srv.log.Error("Failed to export audit log", "user", sess.Username, "error", err)
+	}
+	if err := flush(); err != nil {
+		srv.log.Error("Failed to export audit log", "user", sess.Username, "error", err)
+	}
+}
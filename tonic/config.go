@@ -0,0 +1,375 @@
+package tonic
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by the
+// ConfigLoader if none is specified.
+const DefaultEnvPrefix = "TONIC"
+
+// ConfigLoader loads a service configuration by merging, in increasing order
+// of precedence, the values already set in the configuration (defaults), a
+// configuration file, environment variables, and command line flags.
+//
+// The configuration can be a Config or a struct that embeds a Config to add
+// service-specific fields.  Each value is identified by a key made of the
+// lowercase field names (or the names in the json tags) joined with dots,
+// e.g., "gin.web" or "log.level".  The corresponding environment variable is
+// the upper case key with the dots replaced by underscores and the prefix
+// added, e.g., TONIC_GIN_WEB, and the command line flag is the key itself,
+// e.g., -gin.web.  String, boolean, and numeric values, and lists of strings
+// (comma-separated) can be set from the environment and flags; all other
+// values can only be set in the file.
+//
+// Values can also be read from files named in environment variables with the
+// _FILE suffix, e.g., TONIC_GIN_TOKEN_FILE=/run/secrets/gin_token, so that
+// secrets provided as files by Docker or Kubernetes don't need to be written
+// in the configuration file.  Trailing newlines are removed.
+type ConfigLoader struct {
+	// File is the path to the configuration file.  The format is determined
+	// by the extension: .json, .yaml or .yml, or .toml.  The file can also be
+	// set with the -config flag or the <prefix>_CONFIG environment variable.
+	// If the file set here does not exist, it is skipped; a file set by
+	// flag or environment variable must exist.
+	File string
+	// EnvPrefix is the prefix of the environment variables (default:
+	// "TONIC").
+	EnvPrefix string
+	// Args are the command line arguments without the program name (e.g.,
+	// os.Args[1:]).  Flags are not parsed if nil.
+	Args []string
+	// Required lists the keys of values that must be set.
+	Required []string
+}
+
+// MissingConfigError is returned by ConfigLoader.Load when required values
+// are not set.
+type MissingConfigError struct {
+	// Keys of the missing values.
+	Keys []string
+}
+
+func (e *MissingConfigError) Error() string {
+	return fmt.Sprintf("missing required configuration values: %s", strings.Join(e.Keys, ", "))
+}
+
+// configField is a configuration value that can be set from a string.
+type configField struct {
+	key   string
+	value reflect.Value
+}
+
+// Load reads the configuration into dst, which must be a pointer to a Config
+// or to a struct that embeds one.  If any of the Required values is not set
+// after all the sources are merged, a *MissingConfigError listing all of
+// them is returned.
+func (l ConfigLoader) Load(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("configuration must be a pointer to a struct, got %T", dst)
+	}
+	prefix := l.EnvPrefix
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+
+	fields := make([]configField, 0)
+	collectConfigFields(rv.Elem(), "", &fields)
+
+	// Parse flags first to find the config file, but apply them last
+	file, fileRequired := l.File, false
+	if envfile := os.Getenv(prefix + "_CONFIG"); envfile != "" {
+		file, fileRequired = envfile, true
+	}
+	flagValues := make(map[string]string)
+	if l.Args != nil {
+		flagfile, err := parseConfigFlags(l.Args, fields, flagValues)
+		if err != nil {
+			return err
+		}
+		if flagfile != "" {
+			file, fileRequired = flagfile, true
+		}
+	}
+
+	if file != "" {
+		if err := readConfigFile(file, dst); err != nil {
+			if fileRequired || !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		// Reading the file can allocate embedded pointers, so collect the
+		// fields again
+		fields = fields[:0]
+		collectConfigFields(rv.Elem(), "", &fields)
+	}
+
+	for _, field := range fields {
+		name := prefix + "_" + strings.ToUpper(strings.ReplaceAll(field.key, ".", "_"))
+		envval, ok := os.LookupEnv(name)
+		if filename, fileok := os.LookupEnv(name + "_FILE"); fileok {
+			if ok {
+				return fmt.Errorf("only one of the environment variables %s and %s_FILE can be set", name, name)
+			}
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				return fmt.Errorf("failed to read value of %s from file: %v", name, err)
+			}
+			envval, ok = strings.TrimRight(string(data), "\r\n"), true
+			name += "_FILE"
+		}
+		if ok {
+			if err := setConfigValue(field.value, envval); err != nil {
+				return fmt.Errorf("invalid value for environment variable %s: %v", name, err)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if flagval, ok := flagValues[field.key]; ok {
+			if err := setConfigValue(field.value, flagval); err != nil {
+				return fmt.Errorf("invalid value for flag -%s: %v", field.key, err)
+			}
+		}
+	}
+
+	return checkRequired(rv.Elem(), l.Required)
+}
+
+// collectConfigFields appends the values of the struct v that can be set from
+// strings to fields, recursing into nested and embedded structs.  Embedded
+// struct pointers are allocated if nil.
+func collectConfigFields(v reflect.Value, prefix string, fields *[]configField) {
+	t := v.Type()
+	for idx := 0; idx < t.NumField(); idx++ {
+		sf := t.Field(idx)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			// unexported
+			continue
+		}
+		name := configKeyName(sf)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(idx)
+		if sf.Anonymous {
+			if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						continue
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				collectConfigFields(fv, prefix, fields)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		key := prefix + name
+		switch fv.Kind() {
+		case reflect.Struct:
+			collectConfigFields(fv, key+".", fields)
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			*fields = append(*fields, configField{key: key, value: fv})
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.String {
+				*fields = append(*fields, configField{key: key, value: fv})
+			}
+		}
+	}
+}
+
+// configKeyName returns the name of the struct field in configuration keys:
+// the name in the json tag, if set, or the lowercase field name.
+func configKeyName(sf reflect.StructField) string {
+	if tag, ok := sf.Tag.Lookup("json"); ok {
+		name := strings.Split(tag, ",")[0]
+		if name != "" {
+			return name
+		}
+	}
+	return strings.ToLower(sf.Name)
+}
+
+// setConfigValue parses the string s into v according to its type.
+func setConfigValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// flagValue collects the value of a command line flag as a string.
+type flagValue struct {
+	key    string
+	values map[string]string
+	isBool bool
+}
+
+func (f *flagValue) String() string { return "" }
+
+func (f *flagValue) Set(s string) error {
+	f.values[f.key] = s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+// parseConfigFlags parses the command line arguments, storing the string value
+// of each flag that is set in values under its key.  It returns the value of
+// the -config flag.
+func parseConfigFlags(args []string, fields []configField, values map[string]string) (string, error) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	file := fs.String("config", "", "path to configuration file (.json, .yaml, .yml, or .toml)")
+	for _, field := range fields {
+		usage := fmt.Sprintf("set the configuration value %q", field.key)
+		fs.Var(&flagValue{key: field.key, values: values, isBool: field.value.Kind() == reflect.Bool}, field.key, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	return *file, nil
+}
+
+// readConfigFile reads the configuration file into dst.  YAML and TOML files
+// are converted to JSON first so that all formats use the same keys and
+// embedding rules.
+func readConfigFile(filename string, dst interface{}) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+	case ".yaml", ".yml":
+		values := make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", filename, err)
+		}
+		if data, err = json.Marshal(values); err != nil {
+			return fmt.Errorf("failed to convert %s: %v", filename, err)
+		}
+	case ".toml":
+		values := make(map[string]interface{})
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", filename, err)
+		}
+		if data, err = json.Marshal(values); err != nil {
+			return fmt.Errorf("failed to convert %s: %v", filename, err)
+		}
+	default:
+		return fmt.Errorf("unsupported configuration file format %q", ext)
+	}
+
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", filename, err)
+	}
+	return nil
+}
+
+// checkRequired returns a *MissingConfigError listing all the required keys
+// that have zero values (or empty lists) in the configuration.  Unknown keys
+// are reported as missing.
+func checkRequired(v reflect.Value, required []string) error {
+	missing := make([]string, 0)
+	for _, key := range required {
+		value, ok := lookupConfigValue(v, strings.Split(key, "."))
+		if !ok || value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return &MissingConfigError{Keys: missing}
+	}
+	return nil
+}
+
+// lookupConfigValue returns the value in the struct v with the key made of
+// the given names, looking into embedded structs.
+func lookupConfigValue(v reflect.Value, names []string) (reflect.Value, bool) {
+	t := v.Type()
+	for idx := 0; idx < t.NumField(); idx++ {
+		sf := t.Field(idx)
+		fv := v.Field(idx)
+		if sf.Anonymous {
+			if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if value, ok := lookupConfigValue(fv, names); ok {
+					return value, true
+				}
+				continue
+			}
+		}
+		if sf.PkgPath != "" || configKeyName(sf) != names[0] {
+			continue
+		}
+		if len(names) == 1 {
+			return fv, true
+		}
+		if fv.Kind() == reflect.Struct {
+			return lookupConfigValue(fv, names[1:])
+		}
+		return reflect.Value{}, false
+	}
+	return reflect.Value{}, false
+}
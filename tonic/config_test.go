@@ -0,0 +1,184 @@
+package tonic
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// serviceConfig embeds the tonic Config with service-specific fields like a
+// utonic configuration.
+type serviceConfig struct {
+	*Config
+	TemplateRepo string
+	Teams        []string
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+	return path
+}
+
+func TestConfigLoaderFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"gin": {"web": "https://gin.example.org:443", "username": "bot"}, "port": 4000, "templaterepo": "lab/template", "admins": ["alice", "bob"], "retry": {"maxattempts": 3}}`,
+		"config.yaml": "gin:\n  web: https://gin.example.org:443\n  username: bot\nport: 4000\ntemplaterepo: lab/template\nadmins: [alice, bob]\nretry:\n  maxattempts: 3\n",
+		"config.toml": "port = 4000\ntemplaterepo = \"lab/template\"\nadmins = [\"alice\", \"bob\"]\n[gin]\nweb = \"https://gin.example.org:443\"\nusername = \"bot\"\n[retry]\nmaxattempts = 3\n",
+	}
+	for name, content := range files {
+		config := &serviceConfig{Config: &Config{CookieName: "default-cookie"}}
+		loader := ConfigLoader{File: writeConfigFile(t, name, content)}
+		if err := loader.Load(config); err != nil {
+			t.Fatalf("[%s] Failed to load configuration: %v", name, err)
+		}
+		if config.GIN.Web != "https://gin.example.org:443" || config.GIN.Username != "bot" {
+			t.Errorf("[%s] Unexpected GIN configuration: %+v", name, config.GIN)
+		}
+		if config.Port != 4000 || config.Retry.MaxAttempts != 3 {
+			t.Errorf("[%s] Unexpected port or retry configuration: %d %d", name, config.Port, config.Retry.MaxAttempts)
+		}
+		if config.TemplateRepo != "lab/template" {
+			t.Errorf("[%s] Unexpected service-specific value: %q", name, config.TemplateRepo)
+		}
+		if !reflect.DeepEqual(config.Admins, []string{"alice", "bob"}) {
+			t.Errorf("[%s] Unexpected list value: %v", name, config.Admins)
+		}
+		if config.CookieName != "default-cookie" {
+			t.Errorf("[%s] Default value overwritten: %q", name, config.CookieName)
+		}
+	}
+}
+
+func TestConfigLoaderPrecedence(t *testing.T) {
+	file := writeConfigFile(t, "config.json", `{"gin": {"web": "file", "git": "file"}, "port": 1000, "templaterepo": "file"}`)
+
+	t.Setenv("TONIC_GIN_GIT", "env")
+	t.Setenv("TONIC_PORT", "2000")
+	t.Setenv("TONIC_TEMPLATEREPO", "env")
+	t.Setenv("TONIC_TEAMS", "a, b,c")
+	t.Setenv("TONIC_DETECTDUPLICATES", "true")
+
+	config := &serviceConfig{Config: &Config{DBPath: "default"}}
+	loader := ConfigLoader{File: file, Args: []string{"-port", "3000", "-log.level=debug"}}
+	if err := loader.Load(config); err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	expected := map[string][2]string{
+		"default": {config.DBPath, "default"},
+		"file":    {config.GIN.Web, "file"},
+		"env":     {config.GIN.Git, "env"},
+		"env2":    {config.TemplateRepo, "env"},
+		"flag":    {config.Log.Level, "debug"},
+	}
+	for source, values := range expected {
+		if values[0] != values[1] {
+			t.Errorf("Unexpected value from %s: %q (expected %q)", source, values[0], values[1])
+		}
+	}
+	if config.Port != 3000 {
+		t.Errorf("Flag did not override environment: port %d", config.Port)
+	}
+	if !config.DetectDuplicates {
+		t.Error("Boolean value not set from environment")
+	}
+	if !reflect.DeepEqual(config.Teams, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected list from environment: %v", config.Teams)
+	}
+
+	t.Setenv("TONIC_PORT", "notaport")
+	if err := loader.Load(config); err == nil {
+		t.Error("Expected error for invalid port in environment")
+	}
+}
+
+func TestConfigLoaderFiles(t *testing.T) {
+	// a missing default file is skipped
+	config := new(Config)
+	loader := ConfigLoader{File: filepath.Join(t.TempDir(), "missing.json"), Args: []string{}}
+	if err := loader.Load(config); err != nil {
+		t.Fatalf("Missing default configuration file not skipped: %v", err)
+	}
+
+	// a missing file set by flag or environment is an error
+	loader.Args = []string{"-config", loader.File}
+	if err := loader.Load(config); err == nil {
+		t.Fatal("Expected error for missing file set by flag")
+	}
+	loader.Args = nil
+	t.Setenv("TONIC_CONFIG", loader.File)
+	if err := loader.Load(config); err == nil {
+		t.Fatal("Expected error for missing file set by environment")
+	}
+
+	// the file set by environment replaces the default
+	t.Setenv("TONIC_CONFIG", writeConfigFile(t, "other.yml", "cookiename: other\n"))
+	if err := loader.Load(config); err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.CookieName != "other" {
+		t.Fatalf("Configuration file from environment not read: %q", config.CookieName)
+	}
+
+	loader.File = writeConfigFile(t, "config.ini", "port=3000")
+	os.Unsetenv("TONIC_CONFIG")
+	if err := loader.Load(config); err == nil {
+		t.Fatal("Expected error for unsupported file format")
+	}
+}
+
+func TestConfigLoaderRequired(t *testing.T) {
+	config := &serviceConfig{}
+	config.Config = &Config{}
+	config.GIN.Web = "https://gin.example.org:443"
+	loader := ConfigLoader{
+		EnvPrefix: "TESTSERVICE",
+		Required:  []string{"templaterepo", "gin.web", "gin.password", "gin.username", "teams"},
+	}
+	err := loader.Load(config)
+	var missing *MissingConfigError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Expected MissingConfigError, got %v", err)
+	}
+	expected := []string{"gin.password", "gin.username", "teams", "templaterepo"}
+	if !reflect.DeepEqual(missing.Keys, expected) {
+		t.Fatalf("Unexpected missing keys: %v (expected %v)", missing.Keys, expected)
+	}
+
+	t.Setenv("TESTSERVICE_GIN_PASSWORD", "secret")
+	t.Setenv("TESTSERVICE_GIN_USERNAME", "bot")
+	t.Setenv("TESTSERVICE_TEMPLATEREPO", "lab/template")
+	t.Setenv("TESTSERVICE_TEAMS", "team")
+	if err := loader.Load(config); err != nil {
+		t.Fatalf("Failed to load configuration with all required values: %v", err)
+	}
+}
+
+func TestConfigLoaderSecretFiles(t *testing.T) {
+	tokenFile := writeConfigFile(t, "token", "secret-token\n")
+	t.Setenv("TONIC_GIN_TOKEN_FILE", tokenFile)
+
+	config := new(Config)
+	if err := (ConfigLoader{}).Load(config); err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.GIN.Token.Reveal() != "secret-token" {
+		t.Fatalf("Token not read from file: %q", config.GIN.Token.Reveal())
+	}
+
+	t.Setenv("TONIC_GIN_TOKEN", "other-token")
+	if err := (ConfigLoader{}).Load(config); err == nil {
+		t.Fatal("Expected error when both the variable and the file variable are set")
+	}
+
+	os.Unsetenv("TONIC_GIN_TOKEN")
+	t.Setenv("TONIC_GIN_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+	if err := (ConfigLoader{}).Load(config); err == nil {
+		t.Fatal("Expected error for missing secret file")
+	}
+}
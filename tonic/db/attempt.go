@@ -0,0 +1,41 @@
+package db
+
+import (
+	"time"
+)
+
+// Attempt holds the outcome of a single run of a Job.  Jobs that fail with a
+// retryable error are run multiple times and each run is recorded separately.
+type Attempt struct {
+	// Attempt ID (auto)
+	ID int64 `xorm:"pk autoincr"`
+	// ID of the job the attempt belongs to
+	JobID int64 `xorm:"index"`
+	// Number of the attempt, starting at 1
+	Number int
+	// Messages returned from the run
+	Messages []string
+	// Error message (if the run failed)
+	Error string
+	// Time when the run started
+	StartTime time.Time
+	// Time when the run finished
+	EndTime time.Time
+}
+
+// InsertAttempt inserts a new Attempt into the database.
+func (conn *Connection) InsertAttempt(attempt *Attempt) error {
+	_, err := conn.engine.Insert(attempt)
+	return err
+}
+
+// GetJobAttempts retrieves all the Attempts of the Job with the given ID in
+// the order they were run.
+func (conn *Connection) GetJobAttempts(jobID int64) ([]Attempt, error) {
+	attempts := make([]Attempt, 0)
+	condition := Attempt{JobID: jobID}
+	if err := conn.engine.Asc("number").Find(&attempts, &condition); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"time"
+)
+
+// AuditEntry records a change (any request except GET, HEAD, and OPTIONS)
+// made through the GIN API by the bot or a user on behalf of a user of the
+// service.  The audit log is append-only: entries are never updated or
+// deleted.
+type AuditEntry struct {
+	// AuditEntry ID (auto)
+	ID int64 `xorm:"pk autoincr"`
+	// Time when the request was sent
+	Time time.Time `xorm:"index"`
+	// ID of the user who caused the change (the user who submitted the job,
+	// or the logged in user outside of jobs)
+	UserID int64 `xorm:"index"`
+	// ID of the job that made the change (0 outside of jobs)
+	JobID int64 `xorm:"index"`
+	// Account that made the request: "bot" or "user"
+	Actor string
+	// HTTP method and path of the API endpoint (e.g., "POST
+	// /api/v1/org/lab/repos")
+	Method   string
+	Endpoint string
+	// HTTP status code of the response (0 if there was no response)
+	Status int
+	// Error of the request or the error message of the response (empty if
+	// it succeeded)
+	Error string
+}
+
+// Succeeded returns true if the request succeeded.
+func (entry *AuditEntry) Succeeded() bool {
+	return entry.Error == "" && entry.Status >= 200 && entry.Status < 300
+}
+
+// InsertAuditEntry appends a new AuditEntry to the audit log.
+func (conn *Connection) InsertAuditEntry(entry *AuditEntry) error {
+	_, err := conn.engine.Insert(entry)
+	return err
+}
+
+// GetAuditEntries retrieves the most recent AuditEntries, newest first, up to
+// the given limit.
+func (conn *Connection) GetAuditEntries(limit int) ([]AuditEntry, error) {
+	entries := make([]AuditEntry, 0)
+	if err := conn.engine.Desc("id").Limit(limit).Find(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// IterateAuditEntries calls the given function for every AuditEntry in the
+// order they were recorded, optionally limited to the entries of a user or
+// job (if non-zero), and stops at the first error, which is returned.
+func (conn *Connection) IterateAuditEntries(userID, jobID int64, fn func(entry *AuditEntry) error) error {
+	condition := AuditEntry{UserID: userID, JobID: jobID}
+	return conn.engine.Asc("id").Iterate(&condition, func(_ int, bean interface{}) error {
+		return fn(bean.(*AuditEntry))
+	})
+}
@@ -1,10 +1,11 @@
 package db
 
 import (
+	"log/slog"
+
 	// Required for xorm sqlite
 	_ "github.com/mattn/go-sqlite3"
 	"xorm.io/xorm"
-	"xorm.io/xorm/log"
 	"xorm.io/xorm/names"
 )
 
@@ -12,6 +13,7 @@ import (
 // with the Tonic database backend.
 type Connection struct {
 	engine *xorm.Engine
+	log    *slog.Logger
 }
 
 // Close the database.
@@ -19,18 +21,32 @@ func (conn *Connection) Close() error {
 	return conn.engine.Close()
 }
 
+// Ping checks that the database is reachable.
+func (conn *Connection) Ping() error {
+	return conn.engine.Ping()
+}
+
 // New returns a database connection for the sqlite db file at the given path.
-// If it does not exist it is created.
+// If it does not exist it is created.  The connection uses the default slog
+// Logger until another is set with SetLogger().
 func New(path string) (*Connection, error) {
 	db, err := xorm.NewEngine("sqlite3", path)
 	if err != nil {
 		return nil, err
 	}
-	db.Logger().SetLevel(log.LOG_DEBUG)
+	conn := &Connection{engine: db}
+	conn.SetLogger(slog.Default())
 	db.SetMapper(names.GonicMapper{})
 
-	if err := db.Sync2(new(Job), new(Session)); err != nil {
+	if err := db.Sync2(new(Job), new(Session), new(Attempt), new(FailedLogin), new(AuditEntry)); err != nil {
 		return nil, err
 	}
-	return &Connection{db}, nil
+	return conn, nil
+}
+
+// SetLogger sets the logger for the database connection.  SQL statements are
+// logged only if the logger has the debug level enabled.
+func (conn *Connection) SetLogger(l *slog.Logger) {
+	conn.log = l
+	conn.engine.SetLogger(newSQLLogger(l))
 }
@@ -285,4 +285,208 @@ func TestUserJobs(t *testing.T) {
 	} else if err != nil {
 		t.Fatalf("Error retrieving job list: %v", err)
 	}
+
+	// jobs without a form name belong to the default form unless they were
+	// created by a schedule or event
+	db.InsertJob(&Job{UserID: testid, Form: DefaultForm})
+	db.InsertJob(&Job{UserID: testid, Form: "module"})
+	db.InsertJob(&Job{UserID: testid, Schedule: "nightly"})
+	db.InsertJob(&Job{UserID: testid, Event: "push"})
+	if jobs, err := db.GetUserFormJobs(testid, DefaultForm); err != nil || len(jobs) != ntest+1 {
+		t.Fatalf("Unexpected default form job count: %d (expected %d): %v", len(jobs), ntest+1, err)
+	}
+	if jobs, err := db.GetUserFormJobs(testid, "module"); err != nil || len(jobs) != 1 {
+		t.Fatalf("Unexpected form job count: %d (expected 1): %v", len(jobs), err)
+	}
+}
+
+func TestJobRetries(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	db, err := New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer db.Close()
+
+	original := &Job{UserID: 42, Label: "original"}
+	if err := db.InsertJob(original); err != nil {
+		t.Fatalf("Failed inserting job: %s", err.Error())
+	}
+	if retries, err := db.GetJobRetries(original.ID); err != nil {
+		t.Fatalf("Failed to retrieve job retries: %s", err.Error())
+	} else if len(retries) != 0 {
+		t.Fatalf("Unexpected retries found for new job: %+v", retries)
+	}
+
+	for idx := 0; idx < 3; idx++ {
+		if err := db.InsertJob(&Job{UserID: 42, Label: "retry", ParentID: original.ID}); err != nil {
+			t.Fatalf("Failed inserting retry job: %s", err.Error())
+		}
+	}
+	db.InsertJob(&Job{UserID: 42, Label: "other"})
+
+	if retries, err := db.GetJobRetries(original.ID); err != nil {
+		t.Fatalf("Failed to retrieve job retries: %s", err.Error())
+	} else if len(retries) != 3 {
+		t.Fatalf("Unexpected retry count: %d (expected 3)", len(retries))
+	} else {
+		for idx := range retries {
+			if retries[idx].Label != "retry" || retries[idx].ParentID != original.ID {
+				t.Fatalf("Unexpected retry job: %d (label %q, parent %d)", retries[idx].ID, retries[idx].Label, retries[idx].ParentID)
+			}
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	values := map[string][]string{
+		"key1":       {"value1"},
+		"key2":       {"value2"},
+		"anotherkey": {"anothervalue"},
+		"multivalue": {"lastvalue1", "lastvalue2", "lastvalue3"},
+	}
+	fp := Fingerprint(values)
+	for idx := 0; idx < 100; idx++ {
+		// copy into a new map to vary insertion and iteration order
+		vcopy := make(map[string][]string, len(values))
+		for k, v := range values {
+			vcopy[k] = v
+		}
+		if fpc := Fingerprint(vcopy); fpc != fp {
+			t.Fatalf("Fingerprint of identical values differs: %s != %s", fpc, fp)
+		}
+	}
+
+	distinct := []map[string][]string{
+		{},
+		{"a": {}},
+		{"a": {""}},
+		{"a": {"xy"}},
+		{"a": {"x"}, "b": {"y"}},
+		{"a": {"x", "y"}},
+		{"ab": {"c"}},
+		{"a": {"bc"}},
+		{"b": {"xy"}},
+	}
+	seen := make(map[string]int)
+	for idx, v := range distinct {
+		fp := Fingerprint(v)
+		if prev, ok := seen[fp]; ok {
+			t.Fatalf("Fingerprint collision between %v and %v", distinct[prev], v)
+		}
+		seen[fp] = idx
+	}
+}
+
+func TestFailedLogins(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	db, err := New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer db.Close()
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		login := &FailedLogin{Username: username, Address: "10.0.0.1", Time: time.Now(), Reason: "invalid credentials"}
+		if err := db.InsertFailedLogin(login); err != nil {
+			t.Fatalf("Failed inserting failed login: %s", err.Error())
+		}
+	}
+	logins, err := db.GetFailedLogins(2)
+	if err != nil {
+		t.Fatalf("Failed to retrieve failed logins: %s", err.Error())
+	}
+	// newest first
+	if len(logins) != 2 || logins[0].Username != "carol" || logins[1].Username != "bob" {
+		t.Fatalf("Unexpected failed logins: %+v", logins)
+	}
+
+	// only the most recent logins are kept
+	for idx := 0; idx < MaxFailedLogins; idx++ {
+		login := &FailedLogin{Username: "mallory", Address: "10.0.0.2", Time: time.Now(), Reason: "invalid credentials"}
+		if err := db.InsertFailedLogin(login); err != nil {
+			t.Fatalf("Failed inserting failed login: %s", err.Error())
+		}
+	}
+	logins, err = db.GetFailedLogins(2 * MaxFailedLogins)
+	if err != nil {
+		t.Fatalf("Failed to retrieve failed logins: %s", err.Error())
+	}
+	if len(logins) != MaxFailedLogins {
+		t.Fatalf("Unexpected number of failed logins: %d != %d", len(logins), MaxFailedLogins)
+	}
+	for _, login := range logins {
+		if login.Username != "mallory" {
+			t.Fatalf("Old failed login was kept: %+v", login)
+		}
+	}
+}
+
+func TestAuditEntries(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	db, err := New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer db.Close()
+
+	inserted := []AuditEntry{
+		{UserID: 1, JobID: 10, Actor: "bot", Method: "POST", Endpoint: "/api/v1/org/lab/repos", Status: 201},
+		{UserID: 2, JobID: 0, Actor: "user", Method: "DELETE", Endpoint: "/api/v1/repos/bob/data", Status: 403, Error: "forbidden"},
+		{UserID: 1, JobID: 11, Actor: "user", Method: "PATCH", Endpoint: "/api/v1/repos/alice/data", Error: "connection refused"},
+	}
+	for idx := range inserted {
+		inserted[idx].Time = time.Now()
+		if err := db.InsertAuditEntry(&inserted[idx]); err != nil {
+			t.Fatalf("Failed inserting audit entry: %s", err.Error())
+		}
+	}
+	if !inserted[0].Succeeded() || inserted[1].Succeeded() || inserted[2].Succeeded() {
+		t.Fatalf("Unexpected outcome of audit entries")
+	}
+
+	entries, err := db.GetAuditEntries(2)
+	if err != nil {
+		t.Fatalf("Failed to retrieve audit entries: %s", err.Error())
+	}
+	// newest first
+	if len(entries) != 2 || entries[0].ID != inserted[2].ID || entries[1].ID != inserted[1].ID {
+		t.Fatalf("Unexpected audit entries: %+v", entries)
+	}
+
+	iterate := func(userID, jobID int64) []int64 {
+		ids := make([]int64, 0)
+		err := db.IterateAuditEntries(userID, jobID, func(entry *AuditEntry) error {
+			ids = append(ids, entry.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to iterate audit entries: %s", err.Error())
+		}
+		return ids
+	}
+	if ids := iterate(0, 0); len(ids) != 3 || ids[0] != inserted[0].ID || ids[2] != inserted[2].ID {
+		t.Errorf("Unexpected audit entries: %v", ids)
+	}
+	if ids := iterate(1, 0); len(ids) != 2 || ids[0] != inserted[0].ID || ids[1] != inserted[2].ID {
+		t.Errorf("Unexpected audit entries of user 1: %v", ids)
+	}
+	if ids := iterate(1, 11); len(ids) != 1 || ids[0] != inserted[2].ID {
+		t.Errorf("Unexpected audit entries of job 11: %v", ids)
+	}
 }
@@ -1,8 +1,11 @@
 package db
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"sort"
 	"sync"
 	"time"
 )
@@ -26,8 +29,33 @@ type Job struct {
 	SubmitTime time.Time
 	// Time when the job finished (0 if ongoing)
 	EndTime time.Time
+	// ID of the job this job was resubmitted from (0 if it is an original
+	// submission)
+	ParentID int64
+	// Number of times the job has been run
+	Attempts int
+	// Key of the rendered form that submitted the job.  Used to detect
+	// repeated submissions of the same form.
+	SubmissionKey string `xorm:"index"`
+	// Name of the schedule that created the job (empty for jobs submitted by
+	// users)
+	Schedule string `xorm:"index"`
+	// Type of the webhook event that created the job (empty for jobs
+	// submitted by users)
+	Event string `xorm:"index"`
+	// Name of the form that created the job (empty for scheduled and event
+	// jobs and for jobs created before services could have several forms)
+	Form string `xorm:"index"`
+	// Fingerprint of the form values (see Fingerprint()).  Used to label jobs
+	// and detect duplicates.
+	Fingerprint string `xorm:"index"`
+	// ID of the trace the job belongs to (empty if tracing is disabled)
+	TraceID string `xorm:"index"`
+	// ID of the span that enqueued the job.  Runs of the job are recorded as
+	// its children.
+	SpanID string
 	// mutex for locking
-	sync.Mutex `xorm:"-"`
+	sync.Mutex `xorm:"-" json:"-"`
 }
 
 // InsertJob inserts a new Job into the database.  Upon successful return, the
@@ -44,7 +72,7 @@ func (conn *Connection) UpdateJob(job *Job) error {
 	// Update only job matching the same ID
 	_, err := conn.engine.ID(job.ID).Update(job)
 	if err != nil {
-		log.Printf("Failed to update job %d in DB: %s", job.ID, err.Error())
+		conn.log.Error("Failed to update job in DB", "job", job.ID, "error", err)
 	}
 	return err
 }
@@ -60,6 +88,81 @@ func (conn *Connection) GetUserJobs(uid int64) ([]Job, error) {
 	return userjobs, nil
 }
 
+// DefaultForm is the name of the form a service was created with.  Jobs the
+// users submitted before services could have several forms have no form name
+// and are listed with it.
+const DefaultForm = "default"
+
+// GetUserFormJobs retrieves the Jobs associated with a given UserID that were
+// created from the named form.
+func (conn *Connection) GetUserFormJobs(uid int64, form string) ([]Job, error) {
+	userjobs := make([]Job, 0)
+	query := conn.engine.Where("form = ?", form)
+	if form == DefaultForm {
+		query = conn.engine.Where("(form = ? OR (form = '' AND schedule = '' AND event = ''))", form)
+	}
+	if err := query.Find(&userjobs, &Job{UserID: uid}); err != nil {
+		return nil, err
+	}
+	return userjobs, nil
+}
+
+// GetUserJobBySubmissionKey retrieves the Job of the given user that was
+// submitted with the given submission key.
+func (conn *Connection) GetUserJobBySubmissionKey(uid int64, key string) (*Job, error) {
+	j := &Job{UserID: uid, SubmissionKey: key}
+	if has, err := conn.engine.Get(j); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, fmt.Errorf("not found")
+	}
+	return j, nil
+}
+
+// GetUnfinishedUserJobs retrieves the Jobs of the given user with the given
+// fingerprint that have not finished yet.
+func (conn *Connection) GetUnfinishedUserJobs(uid int64, fingerprint string) ([]Job, error) {
+	unfinished := make([]Job, 0)
+	condition := Job{UserID: uid, Fingerprint: fingerprint}
+	// zero EndTime is stored as NULL
+	if err := conn.engine.Where("end_time IS NULL").Asc("id").Find(&unfinished, &condition); err != nil {
+		return nil, err
+	}
+	return unfinished, nil
+}
+
+// GetScheduledJobs retrieves the most recent Jobs created by schedules, newest
+// first, up to the given limit.
+func (conn *Connection) GetScheduledJobs(limit int) ([]Job, error) {
+	jobs := make([]Job, 0)
+	if err := conn.engine.Where("schedule != ''").Desc("id").Limit(limit).Find(&jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetEventJobs retrieves the most recent Jobs created by webhook events,
+// newest first, up to the given limit.
+func (conn *Connection) GetEventJobs(limit int) ([]Job, error) {
+	jobs := make([]Job, 0)
+	if err := conn.engine.Where("event != ''").Desc("id").Limit(limit).Find(&jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetJobRetries retrieves all the Jobs that were resubmitted from the Job with
+// the given ID.
+func (conn *Connection) GetJobRetries(id int64) ([]Job, error) {
+	retries := make([]Job, 0)
+	condition := Job{ParentID: id}
+	if err := conn.engine.Asc("id").Find(&retries, &condition); err != nil {
+		return nil, err
+	}
+
+	return retries, nil
+}
+
 // IsFinished returns true if the Job has finished (has an EndTime).
 func (j *Job) IsFinished() bool {
 	j.Lock()
@@ -87,3 +190,36 @@ func (conn *Connection) GetJob(id int64) (*Job, error) {
 	}
 	return j, nil
 }
+
+// Fingerprint returns a hex encoded SHA-256 hash of a canonical serialisation
+// of the given ValueMap.  Keys are sorted and every key and value is prefixed
+// with its length, so the fingerprint does not depend on map iteration order
+// and different maps can't serialise to the same bytes.
+func Fingerprint(values map[string][]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	writeUint := func(n int) {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(n))
+		h.Write(buf[:])
+	}
+	writeString := func(s string) {
+		writeUint(len(s))
+		h.Write([]byte(s))
+	}
+
+	writeUint(len(keys))
+	for _, key := range keys {
+		writeString(key)
+		writeUint(len(values[key]))
+		for _, value := range values[key] {
+			writeString(value)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
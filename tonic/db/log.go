@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"xorm.io/xorm/log"
+)
+
+// sqlLogger implements the xorm ContextLogger interface using a slog.Logger.
+// SQL statements are logged at debug level and only if the logger has debug
+// level enabled.
+type sqlLogger struct {
+	log     *slog.Logger
+	level   log.LogLevel
+	showSQL bool
+}
+
+func newSQLLogger(l *slog.Logger) *sqlLogger {
+	sl := &sqlLogger{log: l.With("component", "db")}
+	ctx := context.Background()
+	switch {
+	case l.Enabled(ctx, slog.LevelDebug):
+		sl.level = log.LOG_DEBUG
+		sl.showSQL = true
+	case l.Enabled(ctx, slog.LevelInfo):
+		sl.level = log.LOG_INFO
+	case l.Enabled(ctx, slog.LevelWarn):
+		sl.level = log.LOG_WARNING
+	default:
+		sl.level = log.LOG_ERR
+	}
+	return sl
+}
+
+// BeforeSQL implements ContextLogger.
+func (l *sqlLogger) BeforeSQL(ctx log.LogContext) {}
+
+// AfterSQL implements ContextLogger.  The query arguments are not logged
+// since they include the access tokens of user sessions.
+func (l *sqlLogger) AfterSQL(ctx log.LogContext) {
+	attrs := []any{"query", ctx.SQL, "duration", ctx.ExecuteTime}
+	if ctx.Err != nil {
+		attrs = append(attrs, "error", ctx.Err)
+	}
+	l.log.Debug("SQL", attrs...)
+}
+
+// Debugf implements ContextLogger.
+func (l *sqlLogger) Debugf(format string, v ...interface{}) {
+	l.log.Debug(fmt.Sprintf(format, v...))
+}
+
+// Errorf implements ContextLogger.
+func (l *sqlLogger) Errorf(format string, v ...interface{}) {
+	l.log.Error(fmt.Sprintf(format, v...))
+}
+
+// Infof implements ContextLogger.
+func (l *sqlLogger) Infof(format string, v ...interface{}) {
+	l.log.Info(fmt.Sprintf(format, v...))
+}
+
+// Warnf implements ContextLogger.
+func (l *sqlLogger) Warnf(format string, v ...interface{}) {
+	l.log.Warn(fmt.Sprintf(format, v...))
+}
+
+// Level implements ContextLogger.
+func (l *sqlLogger) Level() log.LogLevel {
+	return l.level
+}
+
+// SetLevel implements ContextLogger.
+func (l *sqlLogger) SetLevel(lvl log.LogLevel) {
+	l.level = lvl
+}
+
+// ShowSQL implements ContextLogger.
+func (l *sqlLogger) ShowSQL(show ...bool) {
+	if len(show) == 0 {
+		l.showSQL = true
+		return
+	}
+	l.showSQL = show[0]
+}
+
+// IsShowSQL implements ContextLogger.
+func (l *sqlLogger) IsShowSQL() bool {
+	return l.showSQL
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"time"
+)
+
+// FailedLogin records a login to the service that failed or the start of a
+// lockout.
+type FailedLogin struct {
+	// FailedLogin ID (auto)
+	ID int64 `xorm:"pk autoincr"`
+	// Username (or email address) entered on the login page
+	Username string `xorm:"index"`
+	// Address of the client
+	Address string `xorm:"index"`
+	// Time of the login
+	Time time.Time
+	// Reason the login failed (e.g., the error from the GIN server), or
+	// "locked out" if the failure started a lockout
+	Reason string
+}
+
+// MaxFailedLogins is the number of FailedLogins kept in the database.
+const MaxFailedLogins = 1000
+
+// InsertFailedLogin inserts a new FailedLogin into the database and removes
+// the oldest ones beyond MaxFailedLogins.
+func (conn *Connection) InsertFailedLogin(login *FailedLogin) error {
+	if _, err := conn.engine.Insert(login); err != nil {
+		return err
+	}
+	_, err := conn.engine.Where("id <= ?", login.ID-MaxFailedLogins).Delete(new(FailedLogin))
+	return err
+}
+
+// GetFailedLogins retrieves the most recent FailedLogins, newest first, up to
+// the given limit.
+func (conn *Connection) GetFailedLogins(limit int) ([]FailedLogin, error) {
+	logins := make([]FailedLogin, 0)
+	if err := conn.engine.Desc("id").Limit(limit).Find(&logins); err != nil {
+		return nil, err
+	}
+	return logins, nil
+}
@@ -15,6 +15,8 @@ type Session struct {
 	Token string
 	// ID of the user who owns the session (maps to GIN user ID)
 	UserID int64
+	// Login name of the user who owns the session
+	Username string
 	// Time when the session was created (for expiration)
 	Created time.Time
 }
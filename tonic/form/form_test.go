@@ -3,10 +3,10 @@ package form
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"testing"
 
 	"github.com/G-Node/tonic/templates"
+	"github.com/G-Node/tonic/tonic/web"
 	"golang.org/x/net/html"
 )
 
@@ -42,7 +42,7 @@ func TestFormElementsHTML(t *testing.T) {
 	}
 
 	// render form and check if it's valid HTML
-	tmpl := template.New("layout")
+	tmpl := web.New(0).NewTemplate("layout")
 	tmpl, err := tmpl.Parse(templates.Layout)
 	if err != nil {
 		t.Fatalf("Failed to parse Layout template: %s", err.Error())
@@ -143,7 +143,11 @@ func (e *Element) HTML(ro bool) template.HTML {
 		lines := make([]string, 0, len(e.ValueList)+2)
 		lines = append(lines, fmt.Sprintf("<select id=%q name=%q>", e.ID, e.Name))
 		for _, value := range e.ValueList {
-			lines = append(lines, fmt.Sprintf("<option value=%q>%s</option>", value, value))
+			selected := ""
+			if value == e.Value {
+				selected = "selected"
+			}
+			lines = append(lines, fmt.Sprintf("<option value=%q %s>%s</option>", value, selected, value))
 		}
 		lines = append(lines, "</select>")
 		field = strings.Join(lines, "\n")
@@ -166,6 +170,65 @@ func (e *Element) HTML(ro bool) template.HTML {
 	return template.HTML(label + field + description)
 }
 
+// Copy returns a deep copy of the Form, so that element values and lists can
+// be modified without affecting the original.
+func (f *Form) Copy() *Form {
+	fc := new(Form)
+	fc.Name = f.Name
+	fc.Description = f.Description
+	fc.Pages = make([]Page, len(f.Pages))
+	for pageIdx := range f.Pages {
+		elements := make([]Element, len(f.Pages[pageIdx].Elements))
+		copy(elements, f.Pages[pageIdx].Elements)
+		for idx := range elements {
+			valueList := make([]string, len(elements[idx].ValueList))
+			copy(valueList, elements[idx].ValueList)
+			elements[idx].ValueList = valueList
+		}
+		fc.Pages[pageIdx].Elements = elements
+		fc.Pages[pageIdx].Description = f.Pages[pageIdx].Description
+	}
+	return fc
+}
+
+// Translate returns a copy of the Form with the form and page descriptions,
+// the form name, and the element labels and descriptions translated with the
+// given function (e.g., i18n.Catalog.T).  Values and value lists are not
+// translated since they are submitted with the form.
+func (f *Form) Translate(t func(string, ...interface{}) string) *Form {
+	fc := f.Copy()
+	tr := func(s string) string {
+		if s == "" {
+			return s
+		}
+		return t(s)
+	}
+	fc.Name = tr(fc.Name)
+	fc.Description = tr(fc.Description)
+	for pageIdx := range fc.Pages {
+		page := &fc.Pages[pageIdx]
+		page.Description = tr(page.Description)
+		for idx := range page.Elements {
+			page.Elements[idx].Label = tr(page.Elements[idx].Label)
+			page.Elements[idx].Description = tr(page.Elements[idx].Description)
+		}
+	}
+	return fc
+}
+
+// SetValues assigns the values in the given map to each element with a
+// matching Name.  Multiple values are joined with newlines.
+func (f *Form) SetValues(values map[string][]string) {
+	for pageIdx := range f.Pages {
+		elements := f.Pages[pageIdx].Elements
+		for idx := range elements {
+			if val, ok := values[elements[idx].Name]; ok {
+				elements[idx].Value = strings.Join(val, "\n")
+			}
+		}
+	}
+}
+
 func sliceContains(strSlice []string, value string) bool {
 	for _, slv := range strSlice {
 		if slv == value {
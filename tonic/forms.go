@@ -0,0 +1,189 @@
+package tonic
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/G-Node/tonic/tonic/db"
+	"github.com/G-Node/tonic/tonic/form"
+	"github.com/G-Node/tonic/tonic/web"
+	"github.com/G-Node/tonic/tonic/worker"
+	"github.com/gorilla/mux"
+)
+
+// DefaultForm is the name of the form the service was created with.  Besides
+// the root of the service, it is served at /forms/default.
+const DefaultForm = db.DefaultForm
+
+// formNamePattern matches valid names of forms added with AddForm.
+var formNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// serviceForm is a form of the service with the actions that prepare it and
+// run the jobs submitted with it.
+type serviceForm struct {
+	name       string
+	form       *form.Form
+	preAction  worker.PreAction
+	postAction worker.PostAction
+}
+
+// path returns the service path where the form is served and submitted.
+func (sf *serviceForm) path() string {
+	if sf.name == DefaultForm {
+		return "/"
+	}
+	return "/forms/" + sf.name
+}
+
+// preprocess runs the PreAction of the form, if any, and returns the form to
+// show to the user.
+func (sf *serviceForm) preprocess(botClient, userClient *worker.Client) (*form.Form, error) {
+	if sf.preAction == nil {
+		return sf.form, nil
+	}
+	return sf.preAction(*sf.form, botClient, userClient)
+}
+
+// AddForm adds a form with the given name (lower case letters, digits, "-",
+// and "_") to the service, which is served at /forms/<name>.  The jobs
+// submitted with the form are prepared and run by its own pre and post
+// actions instead of those of the service, and are tagged with the name of
+// the form.  When a service has more than one form, the root of the service
+// shows a page listing all forms.  Adding a form with the name of a form that
+// was added before replaces it, so the forms can be replaced by a Reloader.
+func (srv *Tonic) AddForm(name string, webform form.Form, preAction worker.PreAction, postAction worker.PostAction) error {
+	if name == DefaultForm || !formNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid form name %q", name)
+	}
+	if len(webform.Pages) == 0 {
+		return fmt.Errorf("No form specified: nil or empty form is invalid")
+	}
+	if preAction == nil && postAction == nil {
+		return fmt.Errorf("No action specified for form %q: Either Pre or Post action should be set", name)
+	}
+	sf := &serviceForm{
+		name:       name,
+		form:       normaliseForm(webform),
+		preAction:  preAction,
+		postAction: postAction,
+	}
+
+	srv.formsLock.Lock()
+	defer srv.formsLock.Unlock()
+	if _, ok := srv.forms[name]; !ok {
+		srv.formNames = append(srv.formNames, name)
+	}
+	srv.forms[name] = sf
+	return nil
+}
+
+// lookupForm returns the form with the given name, or nil if there is none.
+// The DefaultForm is returned for an empty name.
+func (srv *Tonic) lookupForm(name string) *serviceForm {
+	if name == "" || name == DefaultForm {
+		return &serviceForm{
+			name:      DefaultForm,
+			form:      srv.form.Load(),
+			preAction: srv.worker.PreAction,
+			// the worker runs the PostAction of the service
+		}
+	}
+	srv.formsLock.RLock()
+	defer srv.formsLock.RUnlock()
+	return srv.forms[name]
+}
+
+// serviceForms returns the DefaultForm followed by the forms added with
+// AddForm in the order they were added.
+func (srv *Tonic) serviceForms() []*serviceForm {
+	srv.formsLock.RLock()
+	defer srv.formsLock.RUnlock()
+	forms := make([]*serviceForm, 0, len(srv.formNames)+1)
+	forms = append(forms, srv.lookupForm(DefaultForm))
+	for _, name := range srv.formNames {
+		forms = append(forms, srv.forms[name])
+	}
+	return forms
+}
+
+// requestForm returns the form named by the {form} route variable.  If there
+// is no such form, it responds with an error page and returns nil.
+func (srv *Tonic) requestForm(w http.ResponseWriter, r *http.Request) *serviceForm {
+	sf := srv.lookupForm(mux.Vars(r)["form"])
+	if sf == nil {
+		srv.web.ErrorResponse(w, r, http.StatusNotFound, "No such form")
+	}
+	return sf
+}
+
+// jobForm returns the form the job was submitted from.  If the form no longer
+// exists, it responds with an error page and returns nil.
+func (srv *Tonic) jobForm(w http.ResponseWriter, r *http.Request, job *db.Job) *serviceForm {
+	sf := srv.lookupForm(job.Form)
+	if sf == nil {
+		srv.web.ErrorResponse(w, r, http.StatusNotFound, "No such form")
+	}
+	return sf
+}
+
+// formInfo describes a form on the landing page.
+type formInfo struct {
+	Name        string
+	Title       string
+	Description string
+	URL         string
+}
+
+// renderIndex renders the DefaultForm, or the page listing all forms if the
+// service has more than one.
+func (srv *Tonic) renderIndex(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	forms := srv.serviceForms()
+	if len(forms) == 1 {
+		srv.renderFilledForm(w, r, sess, forms[0], nil, 0)
+		return
+	}
+	infos := make([]formInfo, len(forms))
+	for idx, sf := range forms {
+		infos[idx] = formInfo{
+			Name:        sf.name,
+			Title:       sf.form.Name,
+			Description: sf.form.Description,
+			URL:         "/forms/" + sf.name,
+		}
+	}
+	srv.render(w, r, web.FormsTemplate, infos)
+}
+
+// renderNamedForm renders the form named in the request path.
+func (srv *Tonic) renderNamedForm(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	sf := srv.requestForm(w, r)
+	if sf == nil {
+		return
+	}
+	srv.renderFilledForm(w, r, sess, sf, nil, 0)
+}
+
+// processNamedForm submits the form named in the request path.
+func (srv *Tonic) processNamedForm(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	sf := srv.requestForm(w, r)
+	if sf == nil {
+		return
+	}
+	srv.submitForm(w, r, sess, sf)
+}
+
+// normaliseForm returns a copy of the form where any element without a type
+// is a text input.
+func normaliseForm(webform form.Form) *form.Form {
+	newForm := webform.Copy()
+	for pageIdx := range newForm.Pages {
+		elements := newForm.Pages[pageIdx].Elements
+		for idx := range elements {
+			if elements[idx].Type == "" {
+				elements[idx].Type = form.TextInput
+			}
+		}
+	}
+	return newForm
+}
@@ -0,0 +1,145 @@
+package tonic
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/G-Node/tonic/tonic/db"
+	"github.com/G-Node/tonic/tonic/worker"
+	"github.com/gorilla/mux"
+)
+
+// Access defines who can use a handler added by the service.
+type Access int
+
+const (
+	// Public handlers can be used without logging in.  They receive the
+	// session and user client if the user is logged in.
+	Public Access = iota
+	// Authenticated handlers require a logged in user.  Requests without a
+	// session are redirected to the login page.
+	Authenticated
+	// Admin handlers require a logged in service administrator (see
+	// Config.Admins).
+	Admin
+)
+
+// Handler is a function that handles requests to a route added by the
+// service.  It receives the session of the logged in user, the bot client
+// that acts as the service, and a client that acts as the user.  The session
+// and user client are nil for requests to Public handlers without a logged in
+// user.
+type Handler func(w http.ResponseWriter, r *http.Request, sess *db.Session, botClient, userClient *worker.Client)
+
+// PageData is a function that returns the data for rendering a page added by
+// the service (see HandlePage).  Its arguments are the same as those of a
+// Handler.  If it returns an error, an error page is shown instead.
+type PageData func(r *http.Request, sess *db.Session, botClient, userClient *worker.Client) (interface{}, error)
+
+// Handle adds a route for the given path (e.g., "/projects" or
+// "/projects/{name}"; see mux.Router) that calls the handler for requests
+// with one of the given methods (all methods if none are given).  Paths are
+// relative to the base path of the service.  An error is returned if the path
+// is used by a built-in route or another handler.  It must be called before
+// Start.
+func (srv *Tonic) Handle(path string, access Access, handler Handler, methods ...string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("invalid path %q: paths must start with /", path)
+	}
+	if srv.routeExists(path, methods) {
+		return fmt.Errorf("a route for %s already exists", path)
+	}
+
+	authed := func(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+		handler(w, r, sess, srv.botClient(sess), srv.userClient(sess))
+	}
+	var handlerFunc http.HandlerFunc
+	switch access {
+	case Public:
+		handlerFunc = func(w http.ResponseWriter, r *http.Request) {
+			if sess := srv.getSession(r); sess != nil {
+				authed(w, r, sess)
+				return
+			}
+			handler(w, r, nil, srv.botClient(nil), nil)
+		}
+	case Authenticated:
+		handlerFunc = srv.reqLoginHandler(authed)
+	case Admin:
+		handlerFunc = srv.reqAdminHandler(authed)
+	default:
+		return fmt.Errorf("invalid access %d", access)
+	}
+
+	route := srv.web.Router.HandleFunc(path, handlerFunc)
+	if len(methods) > 0 {
+		route.Methods(methods...)
+	}
+	return nil
+}
+
+// HandlePage adds a route for the given path that renders the named page
+// template inside the layout with the data returned by the data function for
+// GET requests.  The page must have been added with AddPage (or be one of the
+// built-in templates).  A nil data function renders the page without data.
+// See Handle for the path and access.
+func (srv *Tonic) HandlePage(path string, access Access, name string, data PageData) error {
+	if srv.web.TemplateText(name) == "" {
+		return fmt.Errorf("unknown page template %q", name)
+	}
+	return srv.Handle(path, access, func(w http.ResponseWriter, r *http.Request, sess *db.Session, botClient, userClient *worker.Client) {
+		var pageData interface{}
+		if data != nil {
+			var err error
+			pageData, err = data(r, sess, botClient, userClient)
+			if err != nil {
+				srv.log.Error("Failed to prepare page data", "page", name, "path", r.URL.Path, "error", err)
+				srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Internal error: Please contact an administrator")
+				return
+			}
+		}
+		srv.render(w, r, name, pageData)
+	}, http.MethodGet)
+}
+
+// Render renders the named page template inside the layout in the language of
+// the request, for use in handlers added with Handle.  An error page is shown
+// if rendering fails.
+func (srv *Tonic) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	srv.render(w, r, name, data)
+}
+
+// ErrorResponse responds with the error page showing the given status and
+// message, for use in handlers added with Handle.  The message is translated
+// to the language of the request.
+func (srv *Tonic) ErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	srv.web.ErrorResponse(w, r, status, message)
+}
+
+// URL returns the given absolute service path prefixed with the base path of
+// the service, for use in links and redirects.
+func (srv *Tonic) URL(path string) string {
+	return srv.web.URL(path)
+}
+
+// routeExists returns true if a request to the path with any of the methods
+// (or GET if none are given) matches an existing route.  Variables in the path
+// are matched as literal text, so conflicts between patterns may not be
+// detected.
+func (srv *Tonic) routeExists(path string, methods []string) bool {
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet}
+	}
+	for _, method := range methods {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			continue
+		}
+		var match mux.RouteMatch
+		if srv.web.Router.Match(req, &match) && match.MatchErr == nil {
+			return true
+		}
+	}
+	return false
+}
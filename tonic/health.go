@@ -0,0 +1,106 @@
+package tonic
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/G-Node/tonic/tonic/worker"
+)
+
+var (
+	errNotRunning  = errors.New("not running")
+	errNotLoggedIn = errors.New("not logged in")
+)
+
+// readinessCheck is the result of a single readiness check.
+type readinessCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// readiness reports whether the service can accept and run jobs.
+type readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []readinessCheck `json:"checks"`
+}
+
+// botCheckTTL is how long the result of the bot check is reused, so that
+// frequent readiness probes don't each make a GIN API call.
+const botCheckTTL = 15 * time.Second
+
+// botCheck caches the result of checking the token of the bot client.
+type botCheck struct {
+	client  *worker.Client
+	checked time.Time
+	err     error
+	lock    sync.Mutex
+}
+
+// check returns the result of the last check of the client if it is recent,
+// or checks the client again.
+func (c *botCheck) check(client *worker.Client) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client == client && time.Since(c.checked) < botCheckTTL {
+		return c.err
+	}
+	_, err := client.GetSelfInfo()
+	c.client, c.checked, c.err = client, time.Now(), err
+	return err
+}
+
+// checkReadiness checks that the database is reachable, the worker is
+// running, and the bot client is logged in with a valid token.  The bot check
+// always succeeds if no GIN server is configured, and its result is reused
+// for botCheckTTL.
+func (srv *Tonic) checkReadiness() readiness {
+	status := readiness{Ready: true}
+	add := func(name string, err error, okmsg string) {
+		check := readinessCheck{Name: name, OK: err == nil, Message: okmsg}
+		if err != nil {
+			check.Message = err.Error()
+			status.Ready = false
+		}
+		status.Checks = append(status.Checks, check)
+	}
+
+	add("database", srv.db.Ping(), "")
+
+	var workerErr error
+	if !srv.worker.Running() {
+		workerErr = errNotRunning
+	}
+	add("worker", workerErr, "")
+
+	if srv.config.Load().GIN.Web == "" {
+		add("bot", nil, "No server configured")
+	} else if client := srv.worker.Client(); client == nil {
+		add("bot", errNotLoggedIn, "")
+	} else {
+		add("bot", srv.botCheck.check(client), "")
+	}
+	return status
+}
+
+// healthz reports that the process is alive and serving requests.
+func (srv *Tonic) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyz reports the result of the readiness checks as JSON.  The status code
+// is 200 if the service is ready and 503 otherwise.
+func (srv *Tonic) readyz(w http.ResponseWriter, r *http.Request) {
+	status := srv.checkReadiness()
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		srv.log.Error("Failed to write readiness status", "error", err)
+	}
+}
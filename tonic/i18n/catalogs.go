@@ -0,0 +1,130 @@
+package i18n
+
+// builtinCatalogs returns the catalogues included with Tonic.  English needs
+// no translations since the messages are the English texts.
+func builtinCatalogs() []Catalog {
+	return []Catalog{
+		{
+			Language:   "en",
+			Name:       "English",
+			TimeFormat: DefaultTimeFormat,
+		},
+		{
+			Language:   "de",
+			Name:       "Deutsch",
+			TimeFormat: "02.01.2006 15:04:05",
+			Messages:   german,
+		},
+	}
+}
+
+var german = map[string]string{
+	// Layout
+	"New":  "Neu",
+	"Jobs": "Aufträge",
+
+	// Login page
+	"Sign In using your GIN credentials": "Mit GIN-Zugangsdaten anmelden",
+	"Username or email":                  "Benutzername oder E-Mail",
+	"Password":                           "Passwort",
+	"Sign In":                            "Anmelden",
+
+	// Form and job view
+	"Submit": "Absenden",
+	"Status": "Status",
+	"Job failed with a temporary error and is queued to be retried": "Der Auftrag ist mit einem vorübergehenden Fehler fehlgeschlagen und wird erneut versucht",
+	"Job is in queue":            "Der Auftrag wartet in der Warteschlange",
+	"Job failed with error:":     "Der Auftrag ist fehlgeschlagen:",
+	"Job completed successfully": "Der Auftrag wurde erfolgreich abgeschlossen",
+	"Submitted":                  "Eingereicht",
+	"Finished":                   "Beendet",
+	"Fingerprint":                "Fingerabdruck",
+	"Trace":                      "Trace",
+	"Retry of":                   "Wiederholung von",
+	"Retried as":                 "Wiederholt als",
+	"Job %d":                     "Auftrag %d",
+	"Retry":                      "Wiederholen",
+	"Edit and resubmit":          "Bearbeiten und erneut einreichen",
+	"Attempts":                   "Versuche",
+	"failed with error:":         "fehlgeschlagen:",
+	"succeeded":                  "erfolgreich",
+	"Job log":                    "Protokoll",
+
+	// Job list
+	"Work log": "Arbeitsprotokoll",
+
+	// Form list
+	"Forms": "Formulare",
+
+	// Admin page
+	"Service status":         "Dienststatus",
+	"Ready":                  "Bereit",
+	"Not ready":              "Nicht bereit",
+	"OK":                     "OK",
+	"Failed":                 "Fehlgeschlagen",
+	"Scheduled jobs":         "Geplante Aufträge",
+	"Name":                   "Name",
+	"Schedule":               "Zeitplan",
+	"Action":                 "Aktion",
+	"Previous run":           "Letzter Lauf",
+	"Next run":               "Nächster Lauf",
+	"Service action":         "Dienstaktion",
+	"Custom action":          "Eigene Aktion",
+	"No scheduled jobs":      "Keine geplanten Aufträge",
+	"Recent scheduled runs":  "Letzte geplante Läufe",
+	"No scheduled runs":      "Keine geplanten Läufe",
+	"Recent webhook events":  "Letzte Webhook-Ereignisse",
+	"No webhook events":      "Keine Webhook-Ereignisse",
+	"Locked out logins":      "Gesperrte Anmeldungen",
+	"Type":                   "Art",
+	"Address or username":    "Adresse oder Benutzername",
+	"Failures":               "Fehlversuche",
+	"Locked until":           "Gesperrt bis",
+	"Address":                "Adresse",
+	"Username":               "Benutzername",
+	"No locked out logins":   "Keine gesperrten Anmeldungen",
+	"Recent failed logins":   "Letzte fehlgeschlagene Anmeldungen",
+	"Time":                   "Zeit",
+	"Reason":                 "Grund",
+	"No failed logins":       "Keine fehlgeschlagenen Anmeldungen",
+	"Recent GIN API changes": "Letzte Änderungen über die GIN-API",
+	"User ID":                "Benutzer-ID",
+	"Job":                    "Auftrag",
+	"Account":                "Konto",
+	"Endpoint":               "Endpunkt",
+	"Outcome":                "Ergebnis",
+	"Bot":                    "Bot",
+	"User":                   "Benutzer",
+	"No GIN API changes":     "Keine Änderungen über die GIN-API",
+	"Export audit log":       "Prüfprotokoll exportieren",
+
+	// Error pages
+	"Bad Request":           "Ungültige Anfrage",
+	"Unauthorized":          "Nicht autorisiert",
+	"Forbidden":             "Verboten",
+	"Not Found":             "Nicht gefunden",
+	"Method Not Allowed":    "Methode nicht erlaubt",
+	"Conflict":              "Konflikt",
+	"Too Many Requests":     "Zu viele Anfragen",
+	"Internal Server Error": "Interner Serverfehler",
+	"Service Unavailable":   "Dienst nicht verfügbar",
+
+	"Administrator access required":                      "Administratorzugang erforderlich",
+	"Internal error: Please contact an administrator":    "Interner Fehler: Bitte wenden Sie sich an einen Administrator",
+	"authentication failed":                              "Anmeldung fehlgeschlagen",
+	"login succeeded but failed to retrieve user data":   "Die Anmeldung war erfolgreich, aber die Benutzerdaten konnten nicht abgerufen werden",
+	"DB write failure. Please contact an administrator.": "Fehler beim Schreiben in die Datenbank. Bitte wenden Sie sich an einen Administrator.",
+	"Invalid ID":                                              "Ungültige ID",
+	"No such job":                                             "Auftrag nicht gefunden",
+	"unauthorized":                                            "nicht autorisiert",
+	"Job has not finished yet":                                "Der Auftrag ist noch nicht beendet",
+	"Only failed jobs can be retried":                         "Nur fehlgeschlagene Aufträge können wiederholt werden",
+	"Error reading jobs from DB":                              "Fehler beim Lesen der Aufträge aus der Datenbank",
+	"Error reading audit log from DB":                         "Fehler beim Lesen des Prüfprotokolls aus der Datenbank",
+	"Error reading failed logins from DB":                     "Fehler beim Lesen der fehlgeschlagenen Anmeldungen aus der Datenbank",
+	"Too many failed logins. Please try again later.":         "Zu viele fehlgeschlagene Anmeldungen. Bitte versuchen Sie es später erneut.",
+	"Invalid parent job ID":                                   "Ungültige ID des ursprünglichen Auftrags",
+	"No such form":                                            "Formular nicht gefunden",
+	"The service is busy. Please try again in a few minutes.": "Der Dienst ist ausgelastet. Bitte versuchen Sie es in einigen Minuten erneut.",
+	"You have too many unfinished jobs. Please wait for them to finish before submitting a new one.": "Sie haben zu viele unbeendete Aufträge. Bitte warten Sie, bis diese beendet sind, bevor Sie einen neuen einreichen.",
+}
@@ -0,0 +1,210 @@
+// Package i18n provides the message catalogues used to translate the Tonic web
+// UI and the selection of a language for each request.
+//
+// Messages are identified by their English text, so untranslated messages are
+// shown in English.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeFormat is the layout of timestamps for catalogues that don't
+// define their own.
+const DefaultTimeFormat = "15:04:05 Mon Jan 2 2006"
+
+// Catalog holds the translations of the UI messages for one language.
+type Catalog struct {
+	// Language is the language tag (e.g., "de").
+	Language string
+	// Name of the language in the language itself (e.g., "Deutsch"), shown
+	// in the language selection.
+	Name string
+	// TimeFormat is the layout of timestamps (see time.Layout).
+	TimeFormat string
+	// Messages maps English messages to their translations.  Messages can be
+	// format strings (see T).
+	Messages map[string]string
+}
+
+// T returns the translation of the message, or the message itself if it
+// isn't translated.  If args are given, the translation is used as a format
+// string for fmt.Sprintf.
+func (c *Catalog) T(message string, args ...interface{}) string {
+	if translation, ok := c.Messages[message]; ok && translation != "" {
+		message = translation
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// FormatTime formats the timestamp with the TimeFormat of the catalogue.  The
+// zero time is formatted as an empty string.
+func (c *Catalog) FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	layout := c.TimeFormat
+	if layout == "" {
+		layout = DefaultTimeFormat
+	}
+	return t.Format(layout)
+}
+
+// Bundle is a set of catalogues with a default language.
+type Bundle struct {
+	catalogs map[string]*Catalog
+	// languages in the order they were added
+	languages []string
+	def       string
+}
+
+// NewBundle returns a bundle with the built-in catalogues (English and
+// German) and the given default language ("en" if empty).  The default
+// language is used when no catalogue matches a request.
+func NewBundle(defaultLanguage string) *Bundle {
+	b := &Bundle{catalogs: make(map[string]*Catalog)}
+	for _, c := range builtinCatalogs() {
+		b.Add(c)
+	}
+	if defaultLanguage == "" {
+		defaultLanguage = "en"
+	}
+	b.def = normalise(defaultLanguage)
+	return b
+}
+
+// Add adds a catalogue to the bundle.  The messages of a catalogue for a
+// language that already exists are merged into it, replacing existing
+// translations, and its Name and TimeFormat replace the existing ones if set.
+func (b *Bundle) Add(c Catalog) {
+	lang := normalise(c.Language)
+	existing, ok := b.catalogs[lang]
+	if !ok {
+		existing = &Catalog{Language: lang, Name: lang, Messages: make(map[string]string)}
+		b.catalogs[lang] = existing
+		b.languages = append(b.languages, lang)
+	}
+	if c.Name != "" {
+		existing.Name = c.Name
+	}
+	if c.TimeFormat != "" {
+		existing.TimeFormat = c.TimeFormat
+	}
+	for msg, translation := range c.Messages {
+		existing.Messages[msg] = translation
+	}
+}
+
+// LoadFile reads a catalogue from a JSON file with the fields of Catalog
+// (e.g., {"language": "fr", "name": "Français", "messages": {"Jobs":
+// "Tâches"}}) and adds it to the bundle.
+func (b *Bundle) LoadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("reading catalogue %s: %v", filename, err)
+	}
+	if c.Language == "" {
+		return fmt.Errorf("reading catalogue %s: no language", filename)
+	}
+	b.Add(c)
+	return nil
+}
+
+// Default returns the catalogue of the default language, falling back to the
+// base language like Lookup (e.g., "de" for "de-DE").  The English catalogue
+// is returned if the bundle has no catalogue for the default language.
+func (b *Bundle) Default() *Catalog {
+	if c := b.Lookup(b.def); c != nil {
+		return c
+	}
+	return b.catalogs["en"]
+}
+
+// Catalogs returns all the catalogues in the order they were added.
+func (b *Bundle) Catalogs() []*Catalog {
+	catalogs := make([]*Catalog, len(b.languages))
+	for idx, lang := range b.languages {
+		catalogs[idx] = b.catalogs[lang]
+	}
+	return catalogs
+}
+
+// Lookup returns the catalogue for the given language tag, falling back to
+// the base language (e.g., "de" for "de-AT").  It returns nil if there is no
+// matching catalogue.
+func (b *Bundle) Lookup(tag string) *Catalog {
+	tag = normalise(tag)
+	if c, ok := b.catalogs[tag]; ok {
+		return c
+	}
+	if base, _, found := strings.Cut(tag, "-"); found {
+		return b.catalogs[base]
+	}
+	return nil
+}
+
+// Match returns the catalogue that best matches an Accept-Language header
+// value, or the default catalogue if none of the languages match.
+func (b *Bundle) Match(acceptLanguage string) *Catalog {
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if c := b.Lookup(tag); c != nil {
+			return c
+		}
+	}
+	return b.Default()
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language header
+// value ordered by their quality values.  Wildcards and tags with a quality
+// of zero are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	result := make([]string, len(tags))
+	for idx := range tags {
+		result[idx] = tags[idx].tag
+	}
+	return result
+}
+
+// normalise returns the language tag in lower case with hyphens (e.g.,
+// "de-at" for "de_AT").
+func normalise(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
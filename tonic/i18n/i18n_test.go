@@ -0,0 +1,102 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	b := NewBundle("")
+	b.Add(Catalog{Language: "fr", Name: "Français"})
+
+	tests := map[string]string{
+		"":                           "en",
+		"de":                         "de",
+		"de-AT,de;q=0.9":             "de",
+		"es, fr;q=0.8, de;q=0.9":     "de",
+		"es, FR_ch;q=0.8, de;q=0":    "fr",
+		"*, es":                      "en",
+		"fr;q=invalid, de;q=0.1":     "de",
+		"en-GB,en;q=0.9,de-DE;q=0.5": "en",
+	}
+	for header, expected := range tests {
+		if lang := b.Match(header).Language; lang != expected {
+			t.Errorf("Match(%q) = %q, expected %q", header, lang, expected)
+		}
+	}
+
+	if c := b.Lookup("pt"); c != nil {
+		t.Errorf("Lookup found catalogue %q for unknown language", c.Language)
+	}
+	if def := NewBundle("de_DE").Default(); def.Language != "de" {
+		t.Errorf("Unexpected default catalogue %q for regional default", def.Language)
+	}
+	if def := NewBundle("pt").Default(); def.Language != "en" {
+		t.Errorf("Unexpected default catalogue %q for unknown default", def.Language)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	b := NewBundle("de")
+	de := b.Default()
+	if msg := de.T("Sign In"); msg != "Anmelden" {
+		t.Errorf("Unexpected translation %q", msg)
+	}
+	if msg := de.T("Job %d", 42); msg != "Auftrag 42" {
+		t.Errorf("Unexpected formatted translation %q", msg)
+	}
+	if msg := de.T("Untranslated"); msg != "Untranslated" {
+		t.Errorf("Untranslated message changed to %q", msg)
+	}
+
+	ts := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+	if s := de.FormatTime(ts); s != "05.03.2024 14:07:09" {
+		t.Errorf("Unexpected German timestamp %q", s)
+	}
+	if s := b.Lookup("en").FormatTime(ts); s != "14:07:09 Tue Mar 5 2024" {
+		t.Errorf("Unexpected English timestamp %q", s)
+	}
+	if s := de.FormatTime(time.Time{}); s != "" {
+		t.Errorf("Zero time formatted as %q", s)
+	}
+
+	// added catalogues are merged with existing ones
+	b.Add(Catalog{Language: "DE", Messages: map[string]string{"Sign In": "Einloggen"}})
+	if msg := de.T("Sign In"); msg != "Einloggen" {
+		t.Errorf("Translation was not replaced: %q", msg)
+	}
+	if de.Name != "Deutsch" || de.T("Password") != "Passwort" {
+		t.Error("Merging catalogues dropped existing values")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "fr.json")
+	content := `{"language": "fr", "name": "Français", "timeformat": "02/01/2006 15:04", "messages": {"Jobs": "Tâches"}}`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBundle("")
+	if err := b.LoadFile(filename); err != nil {
+		t.Fatalf("Failed to load catalogue: %v", err)
+	}
+	fr := b.Lookup("fr-CA")
+	if fr == nil || fr.Name != "Français" || fr.T("Jobs") != "Tâches" {
+		t.Fatalf("Unexpected catalogue loaded: %+v", fr)
+	}
+	if catalogs := b.Catalogs(); len(catalogs) != 3 || catalogs[2] != fr {
+		t.Errorf("Unexpected catalogue order")
+	}
+
+	if err := b.LoadFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Loading a missing file succeeded")
+	}
+	os.WriteFile(filename, []byte(`{"name": "Nameless"}`), 0o644)
+	if err := b.LoadFile(filename); err == nil {
+		t.Error("Loading a catalogue without a language succeeded")
+	}
+}
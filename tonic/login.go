@@ -0,0 +1,275 @@
+package tonic
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the login limits (see Config.Login).
+const (
+	defaultLoginMaxFailures = 5
+	defaultLoginWindow      = 15 * time.Minute
+	defaultLoginLockout     = time.Minute
+	defaultLoginMaxLockout  = time.Hour
+)
+
+// loginPolicy defines when logins are locked out after failures.
+type loginPolicy struct {
+	// maxFailures is the number of failed logins within the window after
+	// which logins are locked out (negative: no limit)
+	maxFailures int
+	window      time.Duration
+	// lockout is the duration of the first lockout, which doubles with every
+	// further failure up to maxLockout
+	lockout    time.Duration
+	maxLockout time.Duration
+}
+
+// loginPolicyFromConfig returns the login policy of the configuration with
+// defaults for unset values.
+func loginPolicyFromConfig(config *Config) loginPolicy {
+	policy := loginPolicy{
+		maxFailures: config.Login.MaxFailures,
+		window:      time.Duration(config.Login.Window) * time.Second,
+		lockout:     time.Duration(config.Login.Lockout) * time.Second,
+		maxLockout:  time.Duration(config.Login.MaxLockout) * time.Second,
+	}
+	if policy.maxFailures == 0 {
+		policy.maxFailures = defaultLoginMaxFailures
+	}
+	if policy.window == 0 {
+		policy.window = defaultLoginWindow
+	}
+	if policy.lockout == 0 {
+		policy.lockout = defaultLoginLockout
+	}
+	if policy.maxLockout == 0 {
+		policy.maxLockout = defaultLoginMaxLockout
+	}
+	if policy.maxLockout < policy.lockout {
+		policy.maxLockout = policy.lockout
+	}
+	return policy
+}
+
+// loginInFlightWait is how long clients are asked to wait when their login
+// is refused because the pending logins could reach the maximum number of
+// failures.
+const loginInFlightWait = time.Second
+
+// loginRecord holds the recent failed logins and the logins in progress for a
+// client address or username.
+type loginRecord struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+	// inFlight counts the logins that were allowed by begin and haven't
+	// finished
+	inFlight int
+}
+
+// loginLimiter counts failed logins per client address and per username and
+// locks out further logins for either after too many failures.
+type loginLimiter struct {
+	policy    loginPolicy
+	records   map[string]*loginRecord
+	lastPrune time.Time
+	lock      sync.Mutex
+}
+
+// newLoginLimiter returns a login limiter with the given policy.
+func newLoginLimiter(policy loginPolicy) *loginLimiter {
+	return &loginLimiter{policy: policy, records: make(map[string]*loginRecord)}
+}
+
+// setPolicy replaces the policy of the limiter.  The recorded failures are
+// kept.
+func (l *loginLimiter) setPolicy(policy loginPolicy) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.policy = policy
+}
+
+// Keys of the login records for client addresses and usernames.
+func addressKey(addr string) string {
+	return "address:" + addr
+}
+
+func usernameKey(username string) string {
+	return "username:" + strings.ToLower(username)
+}
+
+// begin reserves a login attempt for the keys, which must be ended with
+// finish.  If any of the keys is locked out, or the logins in progress could
+// lock it out (see allowedInFlight), nothing is reserved and the time to wait
+// before trying again is returned.  Reserving the attempt before the
+// credentials are checked keeps concurrent guesses from getting past the
+// limit.
+func (l *loginLimiter) begin(now time.Time, keys ...string) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.policy.maxFailures < 0 {
+		return 0
+	}
+	l.prune(now)
+	var wait time.Duration
+	for _, key := range keys {
+		rec, ok := l.records[key]
+		if !ok {
+			continue
+		}
+		l.expire(rec, now)
+		if rec.lockedUntil.After(now) {
+			if d := rec.lockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		} else if rec.inFlight >= l.allowedInFlight(rec) && wait < loginInFlightWait {
+			wait = loginInFlightWait
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	for _, key := range keys {
+		l.record(key).inFlight++
+	}
+	return 0
+}
+
+// allowedInFlight returns the number of logins that may be in progress for
+// the record: the failures left before a lockout, or one after a lockout
+// ended, since the next failure locks it out again.  The lock must be held.
+func (l *loginLimiter) allowedInFlight(rec *loginRecord) int {
+	if left := l.policy.maxFailures - rec.failures; left > 1 {
+		return left
+	}
+	return 1
+}
+
+// finish ends a login attempt reserved with begin for the keys.  A failed
+// login is counted for each of the keys, and the keys that reach the maximum
+// number of failures are locked out.  It returns true if a lockout started.
+func (l *loginLimiter) finish(now time.Time, failed bool, keys ...string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	locked := false
+	for _, key := range keys {
+		rec, ok := l.records[key]
+		if ok && rec.inFlight > 0 {
+			rec.inFlight--
+		}
+		if !failed || l.policy.maxFailures < 0 {
+			continue
+		}
+		if !ok {
+			rec = l.record(key)
+		}
+		l.expire(rec, now)
+		rec.failures++
+		rec.last = now
+		if rec.failures >= l.policy.maxFailures {
+			lockout := l.policy.lockout
+			for n := rec.failures - l.policy.maxFailures; n > 0 && lockout < l.policy.maxLockout; n-- {
+				lockout *= 2
+			}
+			if lockout > l.policy.maxLockout {
+				lockout = l.policy.maxLockout
+			}
+			rec.lockedUntil = now.Add(lockout)
+			locked = true
+		}
+	}
+	return locked
+}
+
+// reset forgets the failed logins for the keys.  Logins in progress remain
+// reserved.
+func (l *loginLimiter) reset(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, key := range keys {
+		if rec, ok := l.records[key]; ok && rec.inFlight > 0 {
+			*rec = loginRecord{inFlight: rec.inFlight}
+			continue
+		}
+		delete(l.records, key)
+	}
+}
+
+// record returns the record for the key, creating it if needed.  The lock
+// must be held.
+func (l *loginLimiter) record(key string) *loginRecord {
+	rec, ok := l.records[key]
+	if !ok {
+		rec = new(loginRecord)
+		l.records[key] = rec
+	}
+	return rec
+}
+
+// expired returns true if the failures of the record are outside the window
+// and it isn't locked out.
+func (l *loginLimiter) expired(rec *loginRecord, now time.Time) bool {
+	return now.Sub(rec.last) > l.policy.window && !rec.lockedUntil.After(now)
+}
+
+// expire forgets the failures of the record if they expired.  The lock must
+// be held.
+func (l *loginLimiter) expire(rec *loginRecord, now time.Time) {
+	if l.expired(rec, now) {
+		*rec = loginRecord{inFlight: rec.inFlight}
+	}
+}
+
+// prune removes expired records without logins in progress, at most once per
+// window.  The lock must be held.
+func (l *loginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.policy.window {
+		return
+	}
+	l.lastPrune = now
+	for key, rec := range l.records {
+		if rec.inFlight == 0 && l.expired(rec, now) {
+			delete(l.records, key)
+		}
+	}
+}
+
+// loginLockout describes a client address or username that is locked out.
+type loginLockout struct {
+	// Kind is "address" or "username"
+	Kind     string
+	Value    string
+	Failures int
+	Until    time.Time
+}
+
+// lockouts returns the client addresses and usernames that are currently
+// locked out, ordered by the end of their lockout.
+func (l *loginLimiter) lockouts(now time.Time) []loginLockout {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	lockouts := make([]loginLockout, 0)
+	for key, rec := range l.records {
+		if !rec.lockedUntil.After(now) {
+			continue
+		}
+		kind, value, _ := strings.Cut(key, ":")
+		lockouts = append(lockouts, loginLockout{Kind: kind, Value: value, Failures: rec.failures, Until: rec.lockedUntil})
+	}
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].Until.Before(lockouts[j].Until) })
+	return lockouts
+}
+
+// clientAddress returns the IP address of the client that sent the request
+// (see web.Server.SetTrustedProxies).
+func clientAddress(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,156 @@
+// Package metrics defines the Prometheus metrics collected by Tonic services
+// and the handler that exposes them.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tonic"
+
+// Job states used as label values for finished jobs.
+const (
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+var (
+	// QueueDepth is the number of jobs waiting in the worker queue.
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of jobs waiting in the worker queue.",
+	})
+	// JobsFinished counts finished jobs by final state.
+	JobsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_finished_total",
+		Help:      "Number of finished jobs by final state.",
+	}, []string{"state"})
+	// JobsRejected counts jobs that were not queued by reason (queue_full or
+	// user_limit).
+	JobsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_rejected_total",
+		Help:      "Number of jobs rejected by the worker queue by reason.",
+	}, []string{"reason"})
+	// JobRetries counts job attempts that failed with a retryable error and
+	// were queued again.
+	JobRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_retries_total",
+		Help:      "Number of job attempts that failed with a retryable error and were queued again.",
+	})
+	// JobDuration observes the time from submission to the end of a job by
+	// final state, including time spent in the queue and between retries.
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time from submission to the end of a job by final state.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 1800, 3600},
+	}, []string{"state"})
+	// ActionDuration observes the run time of each job action (PostAction)
+	// attempt.
+	ActionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_action_duration_seconds",
+		Help:      "Run time of each job action attempt.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 1800},
+	})
+	// HTTPRequests counts HTTP requests by route template, method, and
+	// status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method, and status code.",
+	}, []string{"route", "method", "code"})
+	// HTTPDuration observes HTTP request latencies by route template and
+	// method.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	// LoginFailures counts failed logins to the GIN server by client (bot or
+	// user).
+	LoginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Number of failed logins to the GIN server by client (bot or user).",
+	}, []string{"client"})
+	// LoginsRefused counts logins to the service that were refused without
+	// contacting the GIN server because of too many failed logins.
+	LoginsRefused = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_refused_total",
+		Help:      "Number of logins refused because of too many failed logins.",
+	})
+	// GINRequestDuration observes the latencies of GIN API calls made through
+	// worker clients by method and status code.
+	GINRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "gin_request_duration_seconds",
+		Help:      "Latencies of GIN API calls by method and status code (\"error\" if the request failed).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+)
+
+// Registry holds all the Tonic metrics and the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		QueueDepth,
+		JobsFinished,
+		JobsRejected,
+		JobRetries,
+		JobDuration,
+		ActionDuration,
+		HTTPRequests,
+		HTTPDuration,
+		LoginFailures,
+		LoginsRefused,
+		GINRequestDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns an http.Handler that exposes the metrics in the Prometheus
+// text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// transport is an http.RoundTripper that observes the latency of each request.
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	GINRequestDuration.WithLabelValues(req.Method, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// InstrumentTransport wraps the given RoundTripper (or
+// http.DefaultTransport if nil) to record the latency of GIN API calls.
+func InstrumentTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
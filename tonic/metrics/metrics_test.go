@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sampleCount returns the number of observations of the GIN request duration
+// histogram with the given labels.
+func sampleCount(t *testing.T, method, code string) uint64 {
+	m := new(dto.Metric)
+	if err := GINRequestDuration.WithLabelValues(method, code).(prometheus.Metric).Write(m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	before := sampleCount(t, "GET", "404")
+	client := &http.Client{Transport: InstrumentTransport(nil)}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if n := sampleCount(t, "GET", "404"); n != before+1 {
+		t.Fatalf("Expected %d observations, got %d", before+1, n)
+	}
+
+	ts.Close()
+	before = sampleCount(t, "GET", "error")
+	if _, err := client.Get(ts.URL); err == nil {
+		t.Fatal("Request to closed server succeeded")
+	}
+	if n := sampleCount(t, "GET", "error"); n != before+1 {
+		t.Fatalf("Expected failed request to be observed with code \"error\": got %d observations, expected %d", n, before+1)
+	}
+}
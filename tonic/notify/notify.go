@@ -0,0 +1,167 @@
+// Package notify implements worker.Notifier types that send notifications
+// when jobs finish: email, HTTP webhooks, and GIN issue comments.
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/G-Node/tonic/tonic/db"
+	"github.com/G-Node/tonic/tonic/secret"
+	"github.com/G-Node/tonic/tonic/worker"
+	"github.com/gogs/go-gogs-client"
+)
+
+// summary returns a single line describing the outcome of the job.
+func summary(job *db.Job) string {
+	if job.Error != "" {
+		return fmt.Sprintf("Job %d (%s) failed: %s", job.ID, job.Label, job.Error)
+	}
+	return fmt.Sprintf("Job %d (%s) finished successfully", job.ID, job.Label)
+}
+
+// Email sends an email through an SMTP server when a job finishes.
+type Email struct {
+	// Host and Port of the SMTP server.
+	Host string
+	Port uint16
+	// Username and Password for authenticating with the SMTP server.  If
+	// Username is empty, no authentication is performed.
+	Username string
+	Password secret.String
+	// From is the sender address.
+	From string
+	// To lists addresses that receive a notification for every job.
+	To []string
+	// If NotifyUser is set, the user who submitted the job also receives a
+	// notification at the email address of their GIN account.
+	NotifyUser bool
+	// JobURL is an optional format string for linking to the job view.  It
+	// receives the job ID (e.g., "https://tonic.example.org/log/%d").
+	JobURL string
+}
+
+// Notify sends the email for the finished job.
+func (n *Email) Notify(job *db.Job, botClient, userClient *worker.Client) error {
+	recipients := make([]string, 0, len(n.To)+1)
+	recipients = append(recipients, n.To...)
+	if n.NotifyUser && userClient != nil && job.Schedule == "" && job.Event == "" {
+		user, err := userClient.GetSelfInfo()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve user email address: %v", err)
+		}
+		if user.Email != "" {
+			recipients = append(recipients, user.Email)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	// the summary contains the label and error of the job, which must not
+	// break the header or add headers of their own
+	subject := summary(job)
+	header := mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject))
+	body := new(bytes.Buffer)
+	fmt.Fprintf(body, "From: %s\r\n", n.From)
+	fmt.Fprintf(body, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(body, "Subject: %s\r\n", header)
+	fmt.Fprintf(body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprint(body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(body, "%s\r\n\r\n", subject)
+	for _, msg := range job.Messages {
+		fmt.Fprintf(body, "%s\r\n", msg)
+	}
+	if n.JobURL != "" {
+		fmt.Fprintf(body, "\r\n"+n.JobURL+"\r\n", job.ID)
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password.Reveal(), n.Host)
+	}
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(int(n.Port)))
+	return smtp.SendMail(addr, auth, n.From, recipients, body.Bytes())
+}
+
+// Webhook posts the finished job as JSON to a URL.
+type Webhook struct {
+	// URL that receives the POST request.
+	URL string
+	// If Secret is set, the hex encoded HMAC-SHA256 of the payload is sent
+	// in the X-Tonic-Signature header.
+	Secret secret.String
+	// Client used for sending the request.  If nil, a client with a 30
+	// second timeout is used.
+	Client *http.Client `json:"-"`
+}
+
+// Notify posts the finished job to the webhook URL.
+func (n *Webhook) Notify(job *db.Job, botClient, userClient *worker.Client) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.Secret.Reveal()))
+		mac.Write(payload)
+		req.Header.Set("X-Tonic-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s returned status %s", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// IssueComment adds a comment to an issue on the GIN server, as the bot user,
+// when a job finishes.
+type IssueComment struct {
+	// Repository that holds the issue (owner/name).
+	Repository string
+	// Number of the issue.
+	Issue int64
+}
+
+// Notify adds the comment for the finished job.
+func (n *IssueComment) Notify(job *db.Job, botClient, userClient *worker.Client) error {
+	if botClient == nil {
+		return fmt.Errorf("no bot client available for commenting on %s#%d", n.Repository, n.Issue)
+	}
+	parts := strings.SplitN(n.Repository, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid repository %q: should be of the form owner/name", n.Repository)
+	}
+	lines := make([]string, 0, len(job.Messages)+2)
+	lines = append(lines, fmt.Sprintf("**%s**", summary(job)), "")
+	for _, msg := range job.Messages {
+		lines = append(lines, fmt.Sprintf("- %s", msg))
+	}
+	_, err := botClient.CreateIssueComment(parts[0], parts[1], n.Issue, gogs.CreateIssueCommentOption{Body: strings.Join(lines, "\n")})
+	return err
+}
@@ -0,0 +1,232 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/G-Node/tonic/tonic/db"
+	"github.com/G-Node/tonic/tonic/worker"
+)
+
+// smtpSink is a minimal SMTP server that records the recipients and data of
+// every message it receives.
+type smtpSink struct {
+	listener   net.Listener
+	recipients chan []string
+	data       chan string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start SMTP sink: %v", err)
+	}
+	sink := &smtpSink{listener: listener, recipients: make(chan []string, 1), data: make(chan string, 1)}
+	go sink.serve()
+	return sink
+}
+
+func (s *smtpSink) addr() (string, uint16) {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), uint16(addr.Port)
+}
+
+func (s *smtpSink) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	reply := func(line string) {
+		rw.WriteString(line + "\r\n")
+		rw.Flush()
+	}
+	reply("220 sink ready")
+	recipients := make([]string, 0)
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			recipients = append(recipients, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 send data")
+			data := new(strings.Builder)
+			for {
+				dline, err := rw.ReadString('\n')
+				if err != nil || dline == ".\r\n" {
+					break
+				}
+				data.WriteString(dline)
+			}
+			s.recipients <- recipients
+			s.data <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func testJob() *db.Job {
+	return &db.Job{
+		ID:       42,
+		UserID:   7,
+		Label:    "Project creation: 9f86d0",
+		Messages: []string{"Creating lab/project.main", "Team created: project"},
+		Error:    "failed to add repository",
+		ValueMap: map[string][]string{"project": {"project"}},
+		EndTime:  time.Now(),
+	}
+}
+
+func TestEmail(t *testing.T) {
+	sink := newSMTPSink(t)
+	defer sink.listener.Close()
+
+	host, port := sink.addr()
+	n := &Email{Host: host, Port: port, From: "tonic@example.org", To: []string{"admin@example.org"}, JobURL: "https://tonic.example.org/log/%d"}
+	if err := n.Notify(testJob(), nil, nil); err != nil {
+		t.Fatalf("Failed to send email notification: %v", err)
+	}
+
+	select {
+	case recipients := <-sink.recipients:
+		if len(recipients) != 1 || recipients[0] != "admin@example.org" {
+			t.Fatalf("Unexpected recipients: %v", recipients)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SMTP sink received no message")
+	}
+	data := <-sink.data
+	for _, expected := range []string{"Subject: Job 42 (Project creation: 9f86d0) failed: failed to add repository", "Team created: project", "https://tonic.example.org/log/42"} {
+		if !strings.Contains(data, expected) {
+			t.Fatalf("Email does not contain %q:\n%s", expected, data)
+		}
+	}
+
+	// no recipients: nothing to send
+	if err := (&Email{Host: host, Port: port, From: "tonic@example.org"}).Notify(testJob(), nil, nil); err != nil {
+		t.Fatalf("Email notification without recipients failed: %v", err)
+	}
+}
+
+func TestEmailSubjectInjection(t *testing.T) {
+	sink := newSMTPSink(t)
+	defer sink.listener.Close()
+
+	host, port := sink.addr()
+	n := &Email{Host: host, Port: port, From: "tonic@example.org", To: []string{"admin@example.org"}}
+	job := testJob()
+	job.Error = "failed to add repository\r\nBcc: x"
+	if err := n.Notify(job, nil, nil); err != nil {
+		t.Fatalf("Failed to send email notification: %v", err)
+	}
+
+	select {
+	case recipients := <-sink.recipients:
+		if len(recipients) != 1 || recipients[0] != "admin@example.org" {
+			t.Fatalf("Unexpected recipients: %v", recipients)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SMTP sink received no message")
+	}
+	data := <-sink.data
+	headers, _, _ := strings.Cut(data, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Fatalf("Job error added a header to the email:\n%s", headers)
+		}
+	}
+	if !strings.Contains(headers, "Subject: Job 42 (Project creation: 9f86d0) failed: failed to add repository  Bcc: x\r\n") {
+		t.Fatalf("Email subject does not contain the job error on one line:\n%s", headers)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	payloads := make(chan []byte, 1)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		payloads <- payload
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer sink.Close()
+
+	n := &Webhook{URL: sink.URL + "/hook", Secret: "notify-secret"}
+	if err := n.Notify(testJob(), nil, nil); err != nil {
+		t.Fatalf("Failed to send webhook notification: %v", err)
+	}
+	req := <-received
+	payload := <-payloads
+	mac := hmac.New(sha256.New, []byte("notify-secret"))
+	mac.Write(payload)
+	if sig := req.Header.Get("X-Tonic-Signature"); sig != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("Unexpected webhook signature: %s", sig)
+	}
+	job := new(db.Job)
+	if err := json.Unmarshal(payload, job); err != nil {
+		t.Fatalf("Failed to decode webhook payload: %v", err)
+	}
+	if job.ID != 42 || job.Error != "failed to add repository" || len(job.Messages) != 2 || job.ValueMap["project"][0] != "project" {
+		t.Fatalf("Unexpected webhook payload: %s", string(payload))
+	}
+
+	n = &Webhook{URL: sink.URL + "/fail"}
+	if err := n.Notify(testJob(), nil, nil); err == nil {
+		t.Fatal("Webhook notification succeeded with error response")
+	}
+}
+
+func TestIssueComment(t *testing.T) {
+	comments := make(chan string, 1)
+	gin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/repos/lab/audit/issues/3/comments" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		opt := struct{ Body string }{}
+		json.NewDecoder(r.Body).Decode(&opt)
+		comments <- opt.Body
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer gin.Close()
+
+	botClient := worker.NewClient(gin.URL, "", "bottoken")
+	n := &IssueComment{Repository: "lab/audit", Issue: 3}
+	if err := n.Notify(testJob(), botClient, nil); err != nil {
+		t.Fatalf("Failed to add issue comment: %v", err)
+	}
+	comment := <-comments
+	if !strings.Contains(comment, "Job 42") || !strings.Contains(comment, "- Creating lab/project.main") {
+		t.Fatalf("Unexpected issue comment: %s", comment)
+	}
+
+	if err := (&IssueComment{Repository: "audit", Issue: 3}).Notify(testJob(), botClient, nil); err == nil {
+		t.Fatal("Issue comment with invalid repository succeeded")
+	}
+}
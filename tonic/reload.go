@@ -0,0 +1,100 @@
+package tonic
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/G-Node/tonic/tonic/form"
+)
+
+// Reloader returns a new configuration and form for the service.  It is
+// called when the service is reloaded, typically to read the configuration
+// file again.
+type Reloader func() (Config, form.Form, error)
+
+// SetReloader sets the function that provides the configuration and form
+// when the service is reloaded.  Without a reloader, Reload() fails.
+func (srv *Tonic) SetReloader(r Reloader) {
+	srv.reloadLock.Lock()
+	defer srv.reloadLock.Unlock()
+	srv.reloader = r
+}
+
+// OnReload adds a function that is called after every successful reload.
+// Services that read their own settings in the reloader should apply them
+// here, so that a configuration rejected by Reload leaves them unchanged as
+// well.
+func (srv *Tonic) OnReload(fn func()) {
+	srv.reloadLock.Lock()
+	defer srv.reloadLock.Unlock()
+	srv.reloadHooks = append(srv.reloadHooks, fn)
+}
+
+// Reload replaces the configuration and form of the running service with the
+// ones returned by the reloader.  Settings that require a restart (the name,
+// logging, GIN server and credentials, port, TLS, base path, trusted proxies,
+// languages, assets directory, cookie name, database path, queue capacity,
+// and tracing) keep their current values; a warning is logged if they
+// changed.  If the new configuration or form is invalid, the service is left
+// unchanged and the OnReload functions are not called.
+func (srv *Tonic) Reload() error {
+	srv.reloadLock.Lock()
+	defer srv.reloadLock.Unlock()
+
+	if srv.reloader == nil {
+		return fmt.Errorf("no reloader set")
+	}
+	config, webform, err := srv.reloader()
+	if err != nil {
+		return fmt.Errorf("reloading configuration: %v", err)
+	}
+	if len(webform.Pages) == 0 {
+		return fmt.Errorf("No form specified: nil or empty form is invalid")
+	}
+
+	current := srv.config.Load()
+	if ignored := keepStructural(&config, current); len(ignored) > 0 {
+		srv.log.Warn("Configuration changes require a restart and were ignored", "keys", ignored)
+	}
+
+	if err := srv.setConfigSchedules(config.Schedules); err != nil {
+		return err
+	}
+	srv.applyConfig(&config)
+	srv.config.Store(&config)
+	srv.SetForm(webform)
+	for _, fn := range srv.reloadHooks {
+		fn()
+	}
+	srv.log.Info("Configuration reloaded")
+	return nil
+}
+
+// keepStructural copies the settings that can't change while the service is
+// running from current to config and returns the keys of the ones that
+// differed.
+func keepStructural(config, current *Config) []string {
+	var changed []string
+	keep := func(key string, dst, src interface{}) {
+		d := reflect.ValueOf(dst).Elem()
+		s := reflect.ValueOf(src).Elem()
+		if !reflect.DeepEqual(d.Interface(), s.Interface()) {
+			changed = append(changed, key)
+			d.Set(s)
+		}
+	}
+	keep("name", &config.Name, &current.Name)
+	keep("log", &config.Log, &current.Log)
+	keep("gin", &config.GIN, &current.GIN)
+	keep("port", &config.Port, &current.Port)
+	keep("tls", &config.TLS, &current.TLS)
+	keep("basepath", &config.BasePath, &current.BasePath)
+	keep("trustedproxies", &config.TrustedProxies, &current.TrustedProxies)
+	keep("locale", &config.Locale, &current.Locale)
+	keep("assetsdir", &config.AssetsDir, &current.AssetsDir)
+	keep("cookiename", &config.CookieName, &current.CookieName)
+	keep("dbpath", &config.DBPath, &current.DBPath)
+	keep("queue.capacity", &config.Queue.Capacity, &current.Queue.Capacity)
+	keep("tracing", &config.Tracing, &current.Tracing)
+	return changed
+}
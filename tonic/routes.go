@@ -1,21 +1,21 @@
 package tonic
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"context"
+	"encoding/json"
 	"fmt"
-	"html/template"
-	"io"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/G-Node/tonic/templates"
+	"github.com/G-Node/tonic/assets"
 	"github.com/G-Node/tonic/tonic/db"
 	"github.com/G-Node/tonic/tonic/form"
+	"github.com/G-Node/tonic/tonic/metrics"
+	"github.com/G-Node/tonic/tonic/web"
 	"github.com/G-Node/tonic/tonic/worker"
 	"github.com/gogs/go-gogs-client"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -27,27 +27,73 @@ type authedHandler func(w http.ResponseWriter, r *http.Request, session *db.Sess
 // Use for pages that require authentication (currently, everything except the login page).
 func (srv *Tonic) reqLoginHandler(handler authedHandler) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(srv.config.CookieName)
-		if err != nil || cookie.Value == "" {
-			http.Redirect(w, r, "/login", http.StatusFound)
+		session := srv.getSession(r)
+		if session == nil {
+			http.Redirect(w, r, srv.web.URL("/login"), http.StatusFound)
 			return
 		}
+		handler(w, r, session)
+	}
+}
 
-		sessid := cookie.Value
-		session, err := srv.db.GetSession(sessid)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusFound)
-			return
+// getSession returns the session of the request's session cookie, or nil if
+// the user isn't logged in.
+func (srv *Tonic) getSession(r *http.Request) *db.Session {
+	cookie, err := r.Cookie(srv.config.Load().CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	session, err := srv.db.GetSession(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	// TODO: Check that the session is still valid (by checking expiration)
+	return session
+}
+
+// isAdmin returns true if the user of the session is a service administrator.
+func (srv *Tonic) isAdmin(sess *db.Session) bool {
+	for _, admin := range srv.config.Load().Admins {
+		if sess.Username != "" && sess.Username == admin {
+			return true
 		}
+	}
+	return false
+}
 
-		// TODO: Check that the session is still valid (by checking expiration)
+// reqAdminHandler acts as middleware to check if the user is logged in and is
+// a service administrator.
+func (srv *Tonic) reqAdminHandler(handler authedHandler) func(w http.ResponseWriter, r *http.Request) {
+	return srv.reqLoginHandler(func(w http.ResponseWriter, r *http.Request, session *db.Session) {
+		if !srv.isAdmin(session) {
+			srv.web.ErrorResponse(w, r, http.StatusForbidden, "Administrator access required")
+			return
+		}
 		handler(w, r, session)
+	})
+}
+
+// userClient returns a Client that acts as the user of the session.  Its
+// changes are recorded in the audit log.
+func (srv *Tonic) userClient(sess *db.Session) *worker.Client {
+	config := srv.config.Load()
+	return worker.NewClient(config.GIN.Web, config.GIN.Git, sess.Token).Audit(srv.db, worker.AuditUser, sess.UserID, 0)
+}
+
+// botClient returns the bot client of the service, which records its changes
+// in the audit log as caused by the user of the session (if any).
+func (srv *Tonic) botClient(sess *db.Session) *worker.Client {
+	var userID int64
+	if sess != nil {
+		userID = sess.UserID
 	}
+	return srv.worker.Client().Audit(srv.db, worker.AuditBot, userID, 0)
 }
 
 // setupWebRoutes sets up the common routes shared by all instances of the service.
 //
-// Login, Form (editable and read-only), and Job log pages
+// Login, Form (editable and read-only), Forms, Job log, and Admin pages, the
+// job and audit log exports, and the webhook, metrics, and health endpoints
 func (srv *Tonic) setupWebRoutes() error {
 	router := srv.web.Router
 	router.StrictSlash(true)
@@ -55,244 +101,547 @@ func (srv *Tonic) setupWebRoutes() error {
 	router.HandleFunc("/login", srv.renderLoginPage).Methods("GET")
 	router.HandleFunc("/login", srv.userLoginPost).Methods("POST")
 
-	router.HandleFunc("/", srv.reqLoginHandler(srv.renderForm)).Methods("GET")
+	router.HandleFunc("/", srv.reqLoginHandler(srv.renderIndex)).Methods("GET")
 	router.HandleFunc("/", srv.reqLoginHandler(srv.processForm)).Methods("POST")
+	router.HandleFunc("/forms/{form}", srv.reqLoginHandler(srv.renderNamedForm)).Methods("GET")
+	router.HandleFunc("/forms/{form}", srv.reqLoginHandler(srv.processNamedForm)).Methods("POST")
 	router.HandleFunc("/log", srv.reqLoginHandler(srv.renderLog)).Methods("GET")
 	router.HandleFunc("/log/{id:[0-9]+}", srv.reqLoginHandler(srv.showJob)).Methods("GET")
+	router.HandleFunc("/log/{id:[0-9]+}/edit", srv.reqLoginHandler(srv.editJob)).Methods("GET")
+	router.HandleFunc("/log/{id:[0-9]+}/retry", srv.reqLoginHandler(srv.retryJob)).Methods("POST")
+	router.HandleFunc("/api/jobs/{id:[0-9]+}", srv.reqLoginHandler(srv.showJobJSON)).Methods("GET")
+	router.HandleFunc("/admin", srv.reqAdminHandler(srv.renderAdmin)).Methods("GET")
+	router.HandleFunc("/admin/audit", srv.reqAdminHandler(srv.exportAudit)).Methods("GET")
+
+	router.HandleFunc("/webhook", srv.receiveWebhook).Methods("POST")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	router.HandleFunc("/healthz", srv.healthz).Methods("GET")
+	router.HandleFunc("/readyz", srv.readyz).Methods("GET")
 
-	router.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets"))))
+	assetHandler := web.AssetHandler(assets.FS, srv.config.Load().AssetsDir)
+	router.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", assetHandler))
 	return nil
 }
 
-func (srv *Tonic) renderLoginPage(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.New("layout")
-	tmpl, err := tmpl.Parse(templates.Layout)
-	if err != nil {
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
-		return
+// render renders the named page and responds with an error page if rendering
+// fails.
+func (srv *Tonic) render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	if err := srv.web.Render(w, r, http.StatusOK, name, data); err != nil {
+		srv.log.Error("Failed to render page", "page", name, "error", err)
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Internal error: Please contact an administrator")
 	}
-	tmpl, err = tmpl.Parse(templates.Login)
-	if err != nil {
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
-		return
-	}
-	tmpl.Execute(w, nil)
+}
+
+func (srv *Tonic) renderLoginPage(w http.ResponseWriter, r *http.Request) {
+	srv.render(w, r, web.LoginTemplate, nil)
 }
 
 func (srv *Tonic) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	config := srv.config.Load()
 	r.ParseForm()
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 	if username == "" || password == "" {
-		srv.web.ErrorResponse(w, http.StatusUnauthorized, "authentication failed")
+		srv.web.ErrorResponse(w, r, http.StatusUnauthorized, "authentication failed")
 		return
 	}
+	addr := clientAddress(r)
+	keys := []string{addressKey(addr), usernameKey(username)}
+	if wait := srv.logins.begin(time.Now(), keys...); wait > 0 {
+		// refused logins are only counted; the lockout was recorded when
+		// it started
+		metrics.LoginsRefused.Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		srv.web.ErrorResponse(w, r, http.StatusTooManyRequests, "Too many failed logins. Please try again later.")
+		return
+	}
+	// loginErr is set if the credentials are rejected
+	var loginErr error
+	defer func() {
+		srv.endLogin(username, addr, keys, loginErr)
+	}()
 
 	// If no GIN.Web server is defined, set the token as the username +
 	// password and let them through with any password.
 	var userToken string
 	var userID int64
-	if srv.config.GIN.Web != "" {
-		client := gogs.NewClient(srv.config.GIN.Web, "")
+	if config.GIN.Web != "" {
+		client := gogs.NewClient(config.GIN.Web, "")
 		tokens, err := client.ListAccessTokens(username, password)
 		if err != nil {
-			srv.web.ErrorResponse(w, http.StatusUnauthorized, "authentication failed")
+			loginErr = err
+			srv.web.ErrorResponse(w, r, http.StatusUnauthorized, "authentication failed")
 			return
 		}
 
+		tokenCreated := false
 		if len(tokens) == 0 {
-			appName := srv.form.Name
+			appName := srv.form.Load().Name
 			token, err := client.CreateAccessToken(username, password, gogs.CreateAccessTokenOption{Name: appName})
-			userToken = token.Sha1
 			if err != nil {
-				srv.web.ErrorResponse(w, http.StatusUnauthorized, "authentication failed")
+				srv.auditTokenCreation(username, 0, err)
+				loginErr = err
+				srv.web.ErrorResponse(w, r, http.StatusUnauthorized, "authentication failed")
 				return
 			}
+			userToken = token.Sha1
+			tokenCreated = true
 		} else {
 			userToken = tokens[0].Sha1
 		}
-		client = gogs.NewClient(srv.config.GIN.Web, userToken)
+		client = gogs.NewClient(config.GIN.Web, userToken)
 		user, err := client.GetSelfInfo()
+		if tokenCreated {
+			// the new token is attributed to the user once the account
+			// is known
+			var uid int64
+			if err == nil {
+				uid = user.ID
+			}
+			srv.auditTokenCreation(username, uid, nil)
+		}
 		if err != nil {
-			srv.web.ErrorResponse(w, http.StatusInternalServerError, "login succeeded but failed to retrieve user data")
+			srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "login succeeded but failed to retrieve user data")
 			return
 		}
 		userID = user.ID
+		// failures of both the entered name and the account name are
+		// forgotten
+		srv.logins.reset(usernameKey(username), usernameKey(user.Login))
+		// the login form also accepts email addresses
+		username = user.Login
 	} else {
 		userToken = username + password
 		userID = -1
 	}
 
 	sess := db.NewSession(userToken, userID)
+	sess.Username = username
 
 	cookie := http.Cookie{
-		Name:    srv.config.CookieName,
+		Name:    config.CookieName,
 		Value:   sess.ID,
+		Path:    srv.web.URL("/"),
 		Expires: time.Now().Add(7 * 24 * time.Hour), // TODO: Configurable expiration
-		Secure:  false,
+		Secure:  web.IsSecure(r),
 	}
 
 	if err := srv.db.InsertSession(sess); err != nil {
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "DB write failure. Please contact an administrator.")
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "DB write failure. Please contact an administrator.")
 		return
 	}
 
 	http.SetCookie(w, &cookie)
 	// Redirect to form
-	http.Redirect(w, r, "/", http.StatusFound)
+	http.Redirect(w, r, srv.web.URL("/"), http.StatusFound)
 }
 
-func (srv *Tonic) renderForm(w http.ResponseWriter, r *http.Request, sess *db.Session) {
-	tmpl := template.New("layout")
-	tmpl, err := tmpl.Parse(templates.Layout)
-	if err != nil {
-		srv.log.Printf("Failed to parse Layout template: %s", err.Error())
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
+// endLogin ends the login attempt of the user from the client address that
+// was reserved for the keys.  If the login failed with the given error, the
+// failure counts towards the lockout of both, and a lockout that starts with
+// it is recorded.
+func (srv *Tonic) endLogin(username, addr string, keys []string, err error) {
+	if err == nil {
+		srv.logins.finish(time.Now(), false, keys...)
 		return
 	}
-	tmpl, err = tmpl.Parse(templates.Form)
-	if err != nil {
-		srv.log.Printf("Failed to parse Form template: %s", err.Error())
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
-		return
+	metrics.LoginFailures.WithLabelValues("user").Inc()
+	srv.log.Warn("Login failed", "username", username, "address", addr, "error", err)
+	locked := srv.logins.finish(time.Now(), true, keys...)
+	srv.recordFailedLogin(username, addr, err.Error())
+	if locked {
+		srv.recordFailedLogin(username, addr, "locked out")
 	}
+}
 
-	userForm, err := srv.worker.PreprocessForm(srv.form, worker.NewClient(srv.config.GIN.Web, srv.config.GIN.Git, sess.Token))
+// recordFailedLogin stores a failed login or the start of a lockout for the
+// admin page.
+func (srv *Tonic) recordFailedLogin(username, addr, reason string) {
+	login := &db.FailedLogin{Username: username, Address: addr, Time: time.Now(), Reason: reason}
+	if err := srv.db.InsertFailedLogin(login); err != nil {
+		srv.log.Error("Failed to record failed login", "username", username, "error", err)
+	}
+}
+
+// renderFilledForm renders the editable form with the given values filled in.
+// If parentID is non-zero, the submitted form creates a job that is linked to
+// the job with the given ID as a retry.
+func (srv *Tonic) renderFilledForm(w http.ResponseWriter, r *http.Request, sess *db.Session, sf *serviceForm, values map[string][]string, parentID int64) {
+	userForm, err := sf.preprocess(srv.botClient(sess), srv.userClient(sess))
 	if err != nil {
 		// TODO: Show error to user
 	}
+	if userForm == nil {
+		userForm = sf.form
+	}
+	// Translate returns a copy, so the values can be set safely
+	userForm = userForm.Translate(srv.web.Locale(r).T)
+	if values != nil {
+		userForm.SetValues(values)
+	}
 	data := make(map[string]interface{})
 	data["form"] = userForm
-
-	if err := tmpl.Execute(w, data); err != nil {
-		srv.log.Printf("Failed to render form: %v", err)
+	data["form_url"] = sf.path()
+	if parentID != 0 {
+		data["parent_id"] = parentID
 	}
+	// Unique key for this rendering of the form to detect repeated
+	// submissions
+	data["submission_key"] = uuid.New().String()
+
+	srv.render(w, r, web.FormTemplate, data)
 }
 
-func (srv *Tonic) showJob(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+// getUserJob retrieves the job specified by the {id} route variable and
+// checks that it belongs to the user of the session, or, if allowAdmin is
+// set, that the user is an administrator.  On failure, it writes the error
+// response and returns nil.
+func (srv *Tonic) getUserJob(w http.ResponseWriter, r *http.Request, sess *db.Session, allowAdmin bool) *db.Job {
 	vars := mux.Vars(r)
 	jobid, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		srv.log.Printf("Failed to parse job ID %s: %s", vars["id"], err.Error())
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Invalid ID")
-		return
+		srv.log.Warn("Failed to parse job ID", "id", vars["id"], "error", err)
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Invalid ID")
+		return nil
 	}
 	job, err := srv.db.GetJob(jobid)
 	if err != nil || job == nil {
-		srv.log.Printf("Job not found %d: %s", jobid, err.Error())
-		srv.web.ErrorResponse(w, http.StatusNotFound, "No such job")
-		return
+		srv.log.Warn("Job not found", "job", jobid, "error", err)
+		srv.web.ErrorResponse(w, r, http.StatusNotFound, "No such job")
+		return nil
 	}
 
-	if job.UserID != sess.UserID {
-		srv.web.ErrorResponse(w, http.StatusUnauthorized, "unauthorized")
-		return
+	if job.UserID != sess.UserID && !(allowAdmin && srv.isAdmin(sess)) {
+		srv.web.ErrorResponse(w, r, http.StatusUnauthorized, "unauthorized")
+		return nil
 	}
+	return job
+}
 
-	tmpl := template.New("layout")
-	tmpl, err = tmpl.Parse(templates.Layout)
-	if err != nil {
-		srv.log.Printf("Failed to parse Layout template: %s", err.Error())
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
+func (srv *Tonic) showJob(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	job := srv.getUserJob(w, r, sess, true)
+	if job == nil {
 		return
 	}
-	tmpl, err = tmpl.Parse(templates.Form)
-	if err != nil {
-		srv.log.Printf("Failed to parse Form template: %s", err.Error())
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
+
+	sf := srv.jobForm(w, r, job)
+	if sf == nil {
 		return
 	}
 
 	// Set up form and assign values to each matching element
 	data := make(map[string]interface{})
-	for _, page := range srv.form.Pages {
+	jobForm := sf.form.Translate(srv.web.Locale(r).T)
+	jobForm.SetValues(job.ValueMap)
+	for _, page := range jobForm.Pages {
 		elements := page.Elements
 		for idx := range elements {
-			if val, ok := job.ValueMap[elements[idx].Name]; ok {
-				elements[idx].Value = strings.Join(val, "\n")
-				// convert <select> elements to regular text <input> to show value
-				if elements[idx].Type == form.Select {
-					elements[idx].Type = form.TextInput
-				}
-				// TODO: Handle checkboxes and radio buttons
+			// convert <select> elements to regular text <input> to show value
+			if elements[idx].Type == form.Select {
+				elements[idx].Type = form.TextInput
 			}
+			// TODO: Handle checkboxes and radio buttons
 		}
 	}
 
 	// Add timestamps and exit message to template data and set read-only
-	data["form"] = srv.form
-	timefmt := "15:04:05 Mon Jan 2 2006"
-	data["submit_time"] = job.SubmitTime.Format(timefmt)
+	data["form"] = jobForm
+	data["form_url"] = sf.path()
+	data["job_id"] = job.ID
+	data["submit_time"] = job.SubmitTime
 	if job.IsFinished() {
-		data["end_time"] = job.EndTime.Format(timefmt)
+		data["end_time"] = job.EndTime
 	}
 	data["messages"] = job.Messages
+	data["fingerprint"] = jobFingerprint(job)
+	data["trace_id"] = job.TraceID
+	// Only list the attempts of jobs that have been retried
+	if job.Attempts > 1 || (job.Attempts > 0 && !job.IsFinished()) {
+		attempts, err := srv.db.GetJobAttempts(job.ID)
+		if err != nil {
+			srv.log.Error("Failed to retrieve job attempts", "job", job.ID, "error", err)
+		}
+		data["attempts"] = attempts
+	}
 	if job.Error != "" {
 		data["error"] = job.Error
+		if job.IsFinished() {
+			// Unique key for the retry button to detect repeated retries
+			data["submission_key"] = uuid.New().String()
+		}
 	}
 	data["readonly"] = true
 
-	if err := tmpl.Execute(w, data); err != nil {
-		srv.log.Printf("Failed to render form: %v", err)
+	// Add the chain of jobs this job was resubmitted from (oldest first) and
+	// the jobs that were resubmitted from this one
+	chain := make([]int64, 0)
+	for parentID := job.ParentID; parentID != 0; {
+		parent, err := srv.db.GetJob(parentID)
+		if err != nil {
+			srv.log.Error("Failed to retrieve parent job", "job", parentID, "error", err)
+			break
+		}
+		chain = append([]int64{parent.ID}, chain...)
+		parentID = parent.ParentID
 	}
-}
-func (srv *Tonic) renderLog(w http.ResponseWriter, r *http.Request, sess *db.Session) {
-	tmpl := template.New("layout")
-	tmpl, err := tmpl.Parse(templates.Layout)
+	data["retry_chain"] = chain
+	retries, err := srv.db.GetJobRetries(job.ID)
 	if err != nil {
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
+		srv.log.Error("Failed to retrieve job retries", "job", job.ID, "error", err)
+	}
+	data["retries"] = retries
+
+	srv.render(w, r, web.FormTemplate, data)
+}
+
+// showJobJSON responds with the job as JSON, including its fingerprint, for
+// use by scripts and other services.
+func (srv *Tonic) showJobJSON(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	job := srv.getUserJob(w, r, sess, true)
+	if job == nil {
 		return
 	}
-	tmpl, err = tmpl.Parse(templates.LogView)
-	if err != nil {
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Internal error: Please contact an administrator")
+	job.Fingerprint = jobFingerprint(job)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		srv.log.Error("Failed to write job", "job", job.ID, "error", err)
+	}
+}
+
+// jobFingerprint returns the fingerprint of the job's values.
+func jobFingerprint(job *db.Job) string {
+	if job.Fingerprint != "" {
+		return job.Fingerprint
+	}
+	// jobs created before fingerprints were stored
+	return db.Fingerprint(job.ValueMap)
+}
+
+// editJob renders the form filled with the values of an existing job so that
+// the user can edit and resubmit them as a new job.
+func (srv *Tonic) editJob(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	job := srv.getUserJob(w, r, sess, false)
+	if job == nil {
 		return
 	}
+	if !job.IsFinished() {
+		srv.web.ErrorResponse(w, r, http.StatusConflict, "Job has not finished yet")
+		return
+	}
+	sf := srv.jobForm(w, r, job)
+	if sf == nil {
+		return
+	}
+	srv.renderFilledForm(w, r, sess, sf, job.ValueMap, job.ID)
+}
 
-	joblog, err := srv.db.GetUserJobs(sess.UserID)
+// retryJob resubmits a failed job with the same values as a new job.
+func (srv *Tonic) retryJob(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	job := srv.getUserJob(w, r, sess, false)
+	if job == nil {
+		return
+	}
+	if !job.IsFinished() || job.Error == "" {
+		srv.web.ErrorResponse(w, r, http.StatusConflict, "Only failed jobs can be retried")
+		return
+	}
+	sf := srv.jobForm(w, r, job)
+	if sf == nil {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		srv.log.Warn("Failed to parse form", "error", err)
+	}
+	existing, dupe, err := srv.enqueueJob(r.Context(), sess, sf, job.ValueMap, job.ID, r.PostForm.Get("_submission"))
 	if err != nil {
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Error reading jobs from DB")
+		srv.enqueueErrorResponse(w, r, err)
 		return
 	}
-	if err := tmpl.Execute(w, joblog); err != nil {
-		srv.log.Printf("Failed to render log: %v", err)
-		srv.web.ErrorResponse(w, http.StatusInternalServerError, "Error showing job listing")
+	if dupe {
+		http.Redirect(w, r, srv.web.URL(fmt.Sprintf("/log/%d", existing)), http.StatusSeeOther)
 		return
 	}
+
+	// redirect to job log
+	http.Redirect(w, r, srv.web.URL("/log"), http.StatusSeeOther)
 }
 
+// renderLog renders the list of the user's jobs, or of the jobs submitted
+// with the form named by the "form" query parameter.
+func (srv *Tonic) renderLog(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	var joblog []db.Job
+	var err error
+	if formName := r.URL.Query().Get("form"); formName != "" {
+		joblog, err = srv.db.GetUserFormJobs(sess.UserID, formName)
+	} else {
+		joblog, err = srv.db.GetUserJobs(sess.UserID)
+	}
+	if err != nil {
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Error reading jobs from DB")
+		return
+	}
+	srv.render(w, r, web.LogViewTemplate, joblog)
+}
+
+// processForm submits the DefaultForm.
 func (srv *Tonic) processForm(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	srv.submitForm(w, r, sess, srv.lookupForm(DefaultForm))
+}
+
+// submitForm creates a job from the values submitted with the given form.
+func (srv *Tonic) submitForm(w http.ResponseWriter, r *http.Request, sess *db.Session, sf *serviceForm) {
 	err := r.ParseForm()
 	if err != nil {
-		srv.log.Printf("Failed to parse form: %v", err)
+		srv.log.Warn("Failed to parse form", "error", err)
 	}
 	postValues := r.PostForm
 	jobValues := make(map[string][]string)
-	for _, page := range srv.form.Pages {
+	for _, page := range sf.form.Pages {
 		elements := page.Elements
 		for idx := range elements {
 			key := elements[idx].Name
 			jobValues[key] = postValues[key]
 		}
 	}
-	client := worker.NewClient(srv.config.GIN.Web, srv.config.GIN.Git, sess.Token)
-	label := fmt.Sprintf("%s: %s", srv.form.Name, hashValues(jobValues)[:6])
-	srv.worker.Enqueue(worker.NewUserJob(client, label, jobValues))
+	var parentID int64
+	if parentStr := postValues.Get("_parent"); parentStr != "" {
+		parentID, err = strconv.ParseInt(parentStr, 10, 64)
+		if err != nil {
+			srv.web.ErrorResponse(w, r, http.StatusBadRequest, "Invalid parent job ID")
+			return
+		}
+		if parent, err := srv.db.GetJob(parentID); err != nil || parent.UserID != sess.UserID {
+			srv.web.ErrorResponse(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+	}
+	existing, dupe, err := srv.enqueueJob(r.Context(), sess, sf, jobValues, parentID, postValues.Get("_submission"))
+	if err != nil {
+		srv.enqueueErrorResponse(w, r, err)
+		return
+	}
+	if dupe {
+		// show the job that was already submitted
+		http.Redirect(w, r, srv.web.URL(fmt.Sprintf("/log/%d", existing)), http.StatusSeeOther)
+		return
+	}
 
 	// redirect to job log
-	http.Redirect(w, r, "/log", http.StatusSeeOther)
+	http.Redirect(w, r, srv.web.URL("/log"), http.StatusSeeOther)
 }
 
-// hashValues returns a sha1 hash of a ValueMap that can be used to uniquely
-// label jobs.  This shouldn't be used as the JobID, since we already use
-// auto-incremental DB keys for that.
-func hashValues(values map[string][]string) string {
-	h := sha1.New()
-	for _, valueSlice := range values {
-		for _, value := range valueSlice {
-			io.WriteString(h, value)
+// enqueueJob creates a new job for the user of the session with the given
+// values of the form and adds it to the worker queue.  The job runs the
+// PostAction of the form and is tagged with its name.  A non-zero parentID links the new
+// job to the job it was resubmitted from.
+//
+// If a job was already submitted by the user with the same submission key, or
+// if duplicate detection is enabled and an unfinished job of the user has the
+// same values from the same form, no new job is created.  In that case, the ID of the existing
+// job is returned along with true.
+//
+// If the job can't be added to the queue, the error from worker.Enqueue is
+// returned.  The job is traced as part of the request in ctx.
+func (srv *Tonic) enqueueJob(ctx context.Context, sess *db.Session, sf *serviceForm, values map[string][]string, parentID int64, submissionKey string) (int64, bool, error) {
+	fingerprint := db.Fingerprint(values)
+
+	// Lock to avoid creating two jobs from concurrent identical submissions
+	// (e.g., double clicking the submit button)
+	srv.submitLock.Lock()
+	defer srv.submitLock.Unlock()
+	if submissionKey != "" {
+		if existing, err := srv.db.GetUserJobBySubmissionKey(sess.UserID, submissionKey); err == nil {
+			srv.log.Info("Form already submitted: ignoring resubmission", "job", existing.ID, "user", sess.UserID)
+			return existing.ID, true, nil
+		}
+	}
+	if srv.config.Load().DetectDuplicates {
+		if pending, err := srv.db.GetUnfinishedUserJobs(sess.UserID, fingerprint); err != nil {
+			srv.log.Error("Failed to retrieve unfinished jobs", "user", sess.UserID, "error", err)
+		} else {
+			for idx := range pending {
+				// jobs without a form name were submitted with the
+				// DefaultForm
+				jobForm := pending[idx].Form
+				if jobForm != sf.name && !(jobForm == "" && sf.name == DefaultForm) {
+					continue
+				}
+				srv.log.Info("Identical job is pending: ignoring submission", "job", pending[idx].ID, "user", sess.UserID)
+				return pending[idx].ID, true, nil
+			}
 		}
 	}
-	hash := h.Sum(nil)
-	return hex.EncodeToString(hash[:])
+
+	client := srv.userClient(sess)
+	label := fmt.Sprintf("%s: %s", sf.form.Name, fingerprint[:6])
+	job := worker.NewUserJob(client, label, values)
+	job.Form = sf.name
+	if sf.postAction != nil {
+		job.SetAction(sf.postAction)
+	}
+	// the session user ID is authoritative (set on login)
+	job.UserID = sess.UserID
+	job.ParentID = parentID
+	job.SubmissionKey = submissionKey
+	if err := srv.worker.EnqueueContext(ctx, job); err != nil {
+		return 0, false, err
+	}
+	return job.ID, false, nil
+}
+
+// busyRetryAfter is the number of seconds clients are asked to wait before
+// resubmitting a job that was rejected because the queue was full.
+const busyRetryAfter = 60
+
+// enqueueErrorResponse renders the error page for a job that was rejected by
+// the worker queue.
+func (srv *Tonic) enqueueErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case worker.ErrQueueFull:
+		w.Header().Set("Retry-After", strconv.Itoa(busyRetryAfter))
+		srv.web.ErrorResponse(w, r, http.StatusServiceUnavailable, "The service is busy. Please try again in a few minutes.")
+	case worker.ErrUserLimit:
+		w.Header().Set("Retry-After", strconv.Itoa(busyRetryAfter))
+		srv.web.ErrorResponse(w, r, http.StatusTooManyRequests, "You have too many unfinished jobs. Please wait for them to finish before submitting a new one.")
+	default:
+		srv.log.Error("Failed to enqueue job", "error", err)
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Internal error: Please contact an administrator")
+	}
+}
+
+// renderAdmin renders the administration page with the readiness of the
+// service, the scheduled jobs, their most recent runs, the most recent
+// webhook event jobs, the locked out and recent failed logins, and the most
+// recent changes made through the GIN API.
+func (srv *Tonic) renderAdmin(w http.ResponseWriter, r *http.Request, sess *db.Session) {
+	runs, err := srv.db.GetScheduledJobs(50)
+	if err != nil {
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Error reading jobs from DB")
+		return
+	}
+	events, err := srv.db.GetEventJobs(50)
+	if err != nil {
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Error reading jobs from DB")
+		return
+	}
+	failedLogins, err := srv.db.GetFailedLogins(50)
+	if err != nil {
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Error reading failed logins from DB")
+		return
+	}
+	auditEntries, err := srv.db.GetAuditEntries(50)
+	if err != nil {
+		srv.web.ErrorResponse(w, r, http.StatusInternalServerError, "Error reading audit log from DB")
+		return
+	}
+	data := make(map[string]interface{})
+	data["readiness"] = srv.checkReadiness()
+	data["schedules"] = srv.scheduleInfo()
+	data["scheduled_runs"] = runs
+	data["event_runs"] = events
+	data["lockouts"] = srv.logins.lockouts(time.Now())
+	data["failed_logins"] = failedLogins
+	data["audit"] = auditEntries
+
+	srv.render(w, r, web.AdminTemplate, data)
 }
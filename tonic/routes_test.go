@@ -2,14 +2,24 @@ package tonic
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/G-Node/tonic/tonic/db"
 	"github.com/G-Node/tonic/tonic/form"
+	"github.com/G-Node/tonic/tonic/i18n"
+	"github.com/G-Node/tonic/tonic/web"
+	"github.com/G-Node/tonic/tonic/worker"
 )
 
 func TestLoginRedirect(t *testing.T) {
@@ -175,4 +185,1110 @@ func TestLogRoutes(t *testing.T) {
 
 	checkJobView(testSession, 1000, 404)
 	checkJobView(otherSession, 1000, 404)
+
+	// the job API includes the fingerprint, also for jobs stored without one
+	values := map[string][]string{"project": {"apiproject"}}
+	srv.db.InsertJob(&db.Job{ID: 30, UserID: 42, Label: jobLabel, ValueMap: values})
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/jobs/30", nil)
+	req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", testSession.ID))
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("job API returned %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var job struct {
+		ID          int64
+		Fingerprint string
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+		t.Fatalf("job API returned invalid JSON: %v", err)
+	}
+	if job.ID != 30 || job.Fingerprint != db.Fingerprint(values) {
+		t.Errorf("job API returned unexpected job: %+v", job)
+	}
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/jobs/30", nil)
+	req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", otherSession.ID))
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("job API returned other user's job: %d", rr.Code)
+	}
+}
+
+func TestRetryRoutes(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: []form.Element{{ID: "projname", Name: "project", Label: "Project"}}}}
+	srv, err := NewService(*f, nil, echoAction, Config{CookieName: "test-cookie"})
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	handler := srv.web.Handler
+
+	testSession := db.NewSession("test-token", 42)
+	srv.db.InsertSession(testSession)
+	otherSession := db.NewSession("other-test-token", 44)
+	srv.db.InsertSession(otherSession)
+
+	values := map[string][]string{"project": {"retryproject"}}
+	srv.db.InsertJob(&db.Job{ID: 12, UserID: 42, Label: "FailedJob", ValueMap: values, EndTime: time.Now(), Error: "team creation failed"})
+	srv.db.InsertJob(&db.Job{ID: 16, UserID: 42, Label: "SucceededJob", ValueMap: values, EndTime: time.Now()})
+	srv.db.InsertJob(&db.Job{ID: 18, UserID: 42, Label: "QueuedJob", ValueMap: values})
+
+	request := func(session *db.Session, method, route string, expectedStatus int) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest(method, route, nil)
+		if err != nil {
+			t.Errorf("failed to create request: %s %s", method, route)
+		}
+		req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", session.ID))
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("%s %s returned wrong status code: got %v expected %v", method, route, status, expectedStatus)
+		}
+		return rr
+	}
+
+	// Edit form is prefilled and linked to the original job
+	rr := request(testSession, "GET", "/log/12/edit", http.StatusOK)
+	content := rr.Body.String()
+	if !strings.Contains(content, `value="retryproject"`) {
+		t.Errorf("edit form does not contain job value: %s", content)
+	}
+	if !strings.Contains(content, `name="_parent" value="12"`) {
+		t.Errorf("edit form does not link to the original job: %s", content)
+	}
+	request(testSession, "GET", "/log/16/edit", http.StatusOK)
+	request(testSession, "GET", "/log/18/edit", http.StatusConflict)
+	request(otherSession, "GET", "/log/12/edit", http.StatusUnauthorized)
+
+	// Only failed jobs can be retried
+	request(testSession, "POST", "/log/12/retry", http.StatusSeeOther)
+	request(testSession, "POST", "/log/16/retry", http.StatusConflict)
+	request(testSession, "POST", "/log/18/retry", http.StatusConflict)
+	request(otherSession, "POST", "/log/12/retry", http.StatusUnauthorized)
+
+	retries, err := srv.db.GetJobRetries(12)
+	if err != nil {
+		t.Fatalf("failed to retrieve job retries: %s", err.Error())
+	}
+	if len(retries) != 1 {
+		t.Fatalf("unexpected number of retries: got %d expected 1", len(retries))
+	}
+	if retries[0].ValueMap["project"][0] != "retryproject" {
+		t.Errorf("retry has unexpected values: %+v", retries[0].ValueMap)
+	}
+
+	// Edited resubmission is linked to the original job
+	rr = httptest.NewRecorder()
+	postReq, err := http.NewRequest("POST", "/", strings.NewReader(url.Values{"project": {"edited"}, "_parent": {"12"}}.Encode()))
+	if err != nil {
+		t.Error("failed to create request: POST /")
+	}
+	postReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	postReq.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", testSession.ID))
+	handler.ServeHTTP(rr, postReq)
+	if status := rr.Code; status != http.StatusSeeOther {
+		t.Errorf("handler returned wrong status code: got %v expected %v", status, http.StatusSeeOther)
+	}
+	if retries, _ := srv.db.GetJobRetries(12); len(retries) != 2 {
+		t.Fatalf("unexpected number of retries: got %d expected 2", len(retries))
+	}
+
+	// Original job view links to the retries
+	rr = request(testSession, "GET", "/log/12", http.StatusOK)
+	if !strings.Contains(rr.Body.String(), "Retried as") {
+		t.Errorf("job view does not show retries")
+	}
+
+	// Repeated retries from the same job view create one job
+	match := regexp.MustCompile(`name="_submission" value="([^"]+)"`).FindStringSubmatch(rr.Body.String())
+	if match == nil {
+		t.Fatalf("job view does not contain a submission key")
+	}
+	retry := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/log/12/retry", strings.NewReader(url.Values{"_submission": {match[1]}}.Encode()))
+		if err != nil {
+			t.Error("failed to create request: POST /log/12/retry")
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", testSession.ID))
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusSeeOther {
+			t.Errorf("handler returned wrong status code: got %v expected %v", status, http.StatusSeeOther)
+		}
+		return rr
+	}
+	retry()
+	retries, _ = srv.db.GetJobRetries(12)
+	if len(retries) != 3 {
+		t.Fatalf("unexpected number of retries: got %d expected 3", len(retries))
+	}
+	rr = retry()
+	if retries, _ := srv.db.GetJobRetries(12); len(retries) != 3 {
+		t.Fatalf("repeated retry created another job: got %d retries expected 3", len(retries))
+	}
+	if location := rr.Header().Get("Location"); !strings.HasSuffix(location, "/log/"+strconv.FormatInt(retries[2].ID, 10)) {
+		t.Errorf("repeated retry does not redirect to the first retry: %s", location)
+	}
+}
+
+func TestDuplicateSubmissions(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: []form.Element{{ID: "projname", Name: "project", Label: "Project"}}}}
+
+	submit := func(srv *Tonic, session *db.Session, values url.Values) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Error("failed to create request: POST /")
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", session.ID))
+		srv.web.Handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusSeeOther {
+			t.Errorf("handler returned wrong status code: got %v expected %v", status, http.StatusSeeOther)
+		}
+		return rr
+	}
+
+	countJobs := func(srv *Tonic, uid int64, nexpected int) {
+		if jobs, err := srv.db.GetUserJobs(uid); err != nil {
+			t.Fatalf("failed to retrieve user jobs: %s", err.Error())
+		} else if len(jobs) != nexpected {
+			t.Errorf("unexpected number of jobs: got %d expected %d", len(jobs), nexpected)
+		}
+	}
+
+	srv, err := NewService(*f, nil, echoAction, Config{CookieName: "test-cookie"})
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	testSession := db.NewSession("test-token", 42)
+	srv.db.InsertSession(testSession)
+
+	// The rendered form carries a submission key
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", testSession.ID))
+	srv.web.Handler.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), `name="_submission"`) {
+		t.Errorf("rendered form does not contain a submission key")
+	}
+
+	// Repeated submission of the same rendered form creates one job
+	values := url.Values{"project": {"dupe"}, "_submission": {"render-1"}}
+	if loc := submit(srv, testSession, values).Header().Get("Location"); loc != "/log" {
+		t.Errorf("unexpected redirect for first submission: %s", loc)
+	}
+	loc := submit(srv, testSession, values).Header().Get("Location")
+	countJobs(srv, 42, 1)
+	job, err := srv.db.GetUserJobBySubmissionKey(42, "render-1")
+	if err != nil {
+		t.Fatalf("failed to retrieve job by submission key: %s", err.Error())
+	}
+	if expected := fmt.Sprintf("/log/%d", job.ID); loc != expected {
+		t.Errorf("unexpected redirect for repeated submission: got %s expected %s", loc, expected)
+	}
+
+	// Same values from a new rendering of the form create a new job unless
+	// duplicate detection is enabled
+	submit(srv, testSession, url.Values{"project": {"dupe"}, "_submission": {"render-2"}})
+	countJobs(srv, 42, 2)
+
+	srv, err = NewService(*f, nil, echoAction, Config{CookieName: "test-cookie", DetectDuplicates: true})
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	srv.db.InsertSession(testSession)
+	submit(srv, testSession, url.Values{"project": {"dupe"}, "_submission": {"render-1"}})
+	submit(srv, testSession, url.Values{"project": {"dupe"}, "_submission": {"render-2"}})
+	countJobs(srv, 42, 1)
+	submit(srv, testSession, url.Values{"project": {"other"}, "_submission": {"render-3"}})
+	countJobs(srv, 42, 2)
+}
+
+func TestBusyQueue(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: []form.Element{{ID: "projname", Name: "project", Label: "Project"}}}}
+	config := Config{CookieName: "test-cookie"}
+	config.Queue.Capacity = 2
+	config.Queue.MaxUserJobs = 1
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+
+	submit := func(session *db.Session, project string, expectedStatus int) {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/", strings.NewReader(url.Values{"project": {project}}.Encode()))
+		if err != nil {
+			t.Error("failed to create request: POST /")
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", session.ID))
+		srv.web.Handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("handler returned wrong status code: got %v expected %v", status, expectedStatus)
+		}
+		if expectedStatus != http.StatusSeeOther && rr.Header().Get("Retry-After") == "" {
+			t.Errorf("busy response is missing the Retry-After header")
+		}
+	}
+
+	sessions := make([]*db.Session, 3)
+	for idx := range sessions {
+		sessions[idx] = db.NewSession("test-token", int64(42+idx))
+		srv.db.InsertSession(sessions[idx])
+	}
+
+	// worker is not started so jobs stay in the queue
+	submit(sessions[0], "one", http.StatusSeeOther)
+	submit(sessions[0], "two", http.StatusTooManyRequests)
+	submit(sessions[1], "three", http.StatusSeeOther)
+	submit(sessions[2], "four", http.StatusServiceUnavailable)
+}
+
+func TestAdminRoutes(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{CookieName: "test-cookie", Admins: []string{"admin"}}
+	config.Schedules = []ScheduledJob{{Name: "nightly-audit", Spec: "@daily"}}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	handler := srv.web.Handler
+
+	userSession := db.NewSession("test-token", 42)
+	userSession.Username = "user"
+	srv.db.InsertSession(userSession)
+	adminSession := db.NewSession("admin-token", 1)
+	adminSession.Username = "admin"
+	srv.db.InsertSession(adminSession)
+
+	srv.db.InsertJob(&db.Job{ID: 12, UserID: 99, Label: "Scheduled: nightly-audit", Schedule: "nightly-audit"})
+
+	request := func(session *db.Session, route string, expectedStatus int) string {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", route, nil)
+		if err != nil {
+			t.Errorf("failed to create request: %s", route)
+		}
+		req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", session.ID))
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("GET %s returned wrong status code: got %v expected %v", route, status, expectedStatus)
+		}
+		return rr.Body.String()
+	}
+
+	request(userSession, "/admin", http.StatusForbidden)
+	request(userSession, "/log/12", http.StatusUnauthorized)
+
+	content := request(adminSession, "/admin", http.StatusOK)
+	if !strings.Contains(content, "nightly-audit") {
+		t.Errorf("admin page does not list scheduled job")
+	}
+	if !strings.Contains(content, `href="/log/12"`) {
+		t.Errorf("admin page does not list scheduled run")
+	}
+	request(adminSession, "/log/12", http.StatusOK)
+	// admins can view but not resubmit other users' jobs
+	request(adminSession, "/log/12/edit", http.StatusUnauthorized)
+}
+
+func TestMetricsRoute(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	srv, err := NewService(*f, nil, echoAction, Config{CookieName: "test-cookie"})
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	handler := srv.web.Handler
+
+	// request a page to record at least one HTTP request
+	req, _ := http.NewRequest("GET", "/login", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	rr := httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("metrics handler returned wrong status code: got %v expected %v", rr.Code, http.StatusOK)
+	}
+	body := rr.Body.String()
+	expected := []string{
+		"tonic_queue_depth ",
+		`tonic_http_requests_total{code="200",method="GET",route="/login"}`,
+		"tonic_http_request_duration_seconds_bucket",
+	}
+	for _, exp := range expected {
+		if !strings.Contains(body, exp) {
+			t.Errorf("metrics output does not contain %q", exp)
+		}
+	}
+}
+
+func TestHealthRoutes(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	srv, err := NewService(*f, nil, echoAction, Config{CookieName: "test-cookie"})
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	handler := srv.web.Handler
+
+	get := func(route string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", route, nil)
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get("/healthz"); rr.Code != http.StatusOK {
+		t.Fatalf("healthz returned wrong status code: got %v expected %v", rr.Code, http.StatusOK)
+	}
+
+	// worker not started
+	rr := get("/readyz")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz returned wrong status code before start: got %v expected %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(rr.Body.String(), `{"name":"worker","ok":false,"message":"not running"}`) {
+		t.Fatalf("readyz did not report stopped worker: %s", rr.Body.String())
+	}
+
+	srv.worker.Start()
+	if rr := get("/readyz"); rr.Code != http.StatusOK {
+		t.Fatalf("readyz returned wrong status code after start: got %v expected %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	// server configured but bot not logged in
+	srv.config.Load().GIN.Web = "http://gin.example.org"
+	rr = get("/readyz")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz returned wrong status code without bot login: got %v expected %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(rr.Body.String(), `{"name":"bot","ok":false,"message":"not logged in"}`) {
+		t.Fatalf("readyz did not report missing bot login: %s", rr.Body.String())
+	}
+	srv.config.Load().GIN.Web = ""
+
+	// the bot check is cached between probes
+	var selfRequests int
+	var lock sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		selfRequests++
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id": 1, "login": "bot"}`)
+	}))
+	defer ts.Close()
+	srv.config.Load().GIN.Web = ts.URL
+	srv.worker.SetClient(worker.NewClient(ts.URL, "git@example.org", "bot-token"))
+	for n := 0; n < 3; n++ {
+		if rr := get("/readyz"); rr.Code != http.StatusOK {
+			t.Fatalf("readyz returned wrong status code with bot login: got %v expected %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+	}
+	lock.Lock()
+	if selfRequests != 1 {
+		t.Errorf("readyz checked the bot %d times within the cache period", selfRequests)
+	}
+	lock.Unlock()
+	srv.botCheck.checked = time.Time{}
+	get("/readyz")
+	lock.Lock()
+	if selfRequests != 2 {
+		t.Errorf("readyz did not check the bot again after the cache period: %d checks", selfRequests)
+	}
+	lock.Unlock()
+	srv.config.Load().GIN.Web = ""
+
+	srv.worker.Stop()
+	time.Sleep(10 * time.Millisecond)
+	if rr := get("/readyz"); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz returned wrong status code after stop: got %v expected %v", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	srv.db.Close()
+	if rr := get("/readyz"); !strings.Contains(rr.Body.String(), `"name":"database","ok":false`) {
+		t.Fatalf("readyz did not report closed database: %s", rr.Body.String())
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{CookieName: "test-cookie", BasePath: "/tonic/lp/", TrustedProxies: []string{"127.0.0.1"}}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	handler := srv.web.Handler
+
+	request := func(method, route string, expectedStatus int) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest(method, route, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %s %s", method, route)
+		}
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Fatalf("%s %s: handler returned wrong status code: got %v expected %v", method, route, status, expectedStatus)
+		}
+		return rr
+	}
+
+	if loc := request("GET", "/tonic/lp/log", http.StatusFound).Header().Get("Location"); loc != "/tonic/lp/login" {
+		t.Fatalf("unexpected login redirect: %q", loc)
+	}
+	if loc := request("GET", "/tonic/lp", http.StatusMovedPermanently).Header().Get("Location"); loc != "/tonic/lp/" {
+		t.Fatalf("unexpected base path redirect: %q", loc)
+	}
+	request("GET", "/log", http.StatusNotFound)
+	request("GET", "/tonic/lp/assets/semantic-2.3.1.min.css", http.StatusOK)
+
+	body := request("GET", "/tonic/lp/login", http.StatusOK).Body.String()
+	for _, expected := range []string{`data-suburl="/tonic/lp"`, `href="/tonic/lp/assets/semantic`, `action="/tonic/lp/login"`, `href="/tonic/lp/log"`} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("login page does not contain %s", expected)
+		}
+	}
+
+	login := func(remote string) *http.Cookie {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/tonic/lp/login", strings.NewReader("username=alice&password=secret"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.RemoteAddr = remote
+		handler.ServeHTTP(rr, req)
+		if loc := rr.Header().Get("Location"); loc != "/tonic/lp/" {
+			t.Fatalf("unexpected redirect after login: %q", loc)
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("unexpected cookies after login: %v", cookies)
+		}
+		return cookies[0]
+	}
+	if cookie := login("127.0.0.1:4321"); cookie.Path != "/tonic/lp/" || !cookie.Secure {
+		t.Fatalf("unexpected session cookie from trusted proxy: path %q, secure %t", cookie.Path, cookie.Secure)
+	}
+	if cookie := login("10.0.0.1:4321"); cookie.Secure {
+		t.Fatal("forwarded headers of untrusted client were applied")
+	}
+}
+
+func TestTheme(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{CookieName: "test-cookie"}
+	config.Theme = web.Theme{
+		Title:  "Lab projects",
+		Logo:   "/assets/lab-logo.png",
+		Links:  []web.Link{{Name: "Help", URL: "https://lab.example.org/help"}},
+		Colors: web.Colors{Primary: "#123456"},
+	}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+
+	if err := srv.SetTemplate("Unknown", `{{ define "content" }}{{ end }}`); err == nil {
+		t.Fatal("setting an unknown template succeeded")
+	}
+	if err := srv.SetTemplate(web.LoginTemplate, `{{ define "content" }}{{ end`); err == nil {
+		t.Fatal("setting an invalid template succeeded")
+	}
+	if err := srv.SetTemplate(web.LoginTemplate, `{{ define "content" }}<p>Lab sign in</p>{{ end }}`); err != nil {
+		t.Fatalf("failed to set template: %s", err.Error())
+	}
+
+	render := func() string {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/login", nil)
+		srv.web.Handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("login page returned %d", rr.Code)
+		}
+		return rr.Body.String()
+	}
+
+	body := render()
+	expected := []string{
+		"<title>Lab projects</title>",
+		`src="/assets/lab-logo.png"`,
+		`href="https://lab.example.org/help">Help</a>`,
+		"#123456",
+		"<p>Lab sign in</p>",
+		// unset values are taken from the default theme
+		web.DefaultTheme().Favicon,
+	}
+	for _, exp := range expected {
+		if !strings.Contains(body, exp) {
+			t.Fatalf("login page does not contain %s", exp)
+		}
+	}
+	if strings.Contains(body, "Datenschutz") {
+		t.Fatal("login page contains the default footer links")
+	}
+
+	// the theme is replaced on reload
+	config.Theme.Title = "Lab projects (test)"
+	srv.SetReloader(func() (Config, form.Form, error) { return config, *f, nil })
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("reload failed: %s", err.Error())
+	}
+	if body := render(); !strings.Contains(body, "<title>Lab projects (test)</title>") {
+		t.Fatal("theme was not replaced on reload")
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: []form.Element{{ID: "name", Name: "name", Label: "Project name"}}}}
+	config := Config{CookieName: "test-cookie"}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	srv.AddCatalog(i18n.Catalog{Language: "de", Messages: map[string]string{"Project name": "Projektname"}})
+	handler := srv.web.Handler
+
+	session := db.NewSession("test-token", 42)
+	session.Username = "user"
+	srv.db.InsertSession(session)
+
+	request := func(route string, header http.Header) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", route, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if body := request("/login", nil).Body.String(); !strings.Contains(body, "Sign In") || !strings.Contains(body, `lang="en"`) {
+		t.Fatal("login page is not in English by default")
+	}
+	if body := request("/login", http.Header{"Accept-Language": {"fr, de-DE;q=0.8"}}).Body.String(); !strings.Contains(body, "Anmelden") || !strings.Contains(body, `lang="de"`) {
+		t.Fatal("login page is not in the accepted language")
+	}
+
+	rr := request("/login?lang=de", nil)
+	if !strings.Contains(rr.Body.String(), "Anmelden") {
+		t.Fatal("login page is not in the chosen language")
+	}
+	var cookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == web.LanguageCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != "de" {
+		t.Fatal("chosen language was not stored in a cookie")
+	}
+	// the stored choice takes precedence over the browser languages
+	header := http.Header{
+		"Cookie":          {fmt.Sprintf("test-cookie=%s; %s=de", session.ID, web.LanguageCookie)},
+		"Accept-Language": {"en"},
+	}
+	if body := request("/", header).Body.String(); !strings.Contains(body, "Projektname") || !strings.Contains(body, "Absenden") {
+		t.Fatal("form is not translated")
+	}
+	rr = request("/log/1000", header)
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "Auftrag nicht gefunden") {
+		t.Fatalf("error page is not translated: %d %s", rr.Code, rr.Body.String())
+	}
+	// the original form is not modified
+	if label := srv.form.Load().Pages[0].Elements[0].Label; label != "Project name" {
+		t.Fatalf("form label changed to %q", label)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{CookieName: "test-cookie", Admins: []string{"admin"}}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+
+	hello := func(w http.ResponseWriter, r *http.Request, sess *db.Session, botClient, userClient *worker.Client) {
+		if sess == nil {
+			fmt.Fprint(w, "hello guest")
+			return
+		}
+		if userClient == nil {
+			t.Error("handler called without user client")
+		}
+		fmt.Fprintf(w, "hello %s", sess.Username)
+	}
+	if err := srv.Handle("/hello", Public, hello, http.MethodGet); err != nil {
+		t.Fatalf("failed to add public handler: %s", err.Error())
+	}
+	if err := srv.Handle("/private", Authenticated, hello); err != nil {
+		t.Fatalf("failed to add authenticated handler: %s", err.Error())
+	}
+	if err := srv.Handle("/secret", Admin, hello); err != nil {
+		t.Fatalf("failed to add admin handler: %s", err.Error())
+	}
+	for _, path := range []string{"/login", "/hello", "/assets/custom.css", "relative"} {
+		if err := srv.Handle(path, Public, hello, http.MethodGet); err == nil {
+			t.Errorf("adding a handler for %s succeeded", path)
+		}
+	}
+	// the same path with a different method is allowed
+	if err := srv.Handle("/hello", Public, hello, http.MethodPost); err != nil {
+		t.Errorf("failed to add handler for another method: %s", err.Error())
+	}
+
+	if err := srv.HandlePage("/missing", Public, "Missing", nil); err == nil {
+		t.Error("adding an unknown page succeeded")
+	}
+	if err := srv.AddPage("Greeting", `{{ define "content" }}<p>Greetings, {{.}}</p>{{ end }}`); err != nil {
+		t.Fatalf("failed to add page: %s", err.Error())
+	}
+	greeting := func(r *http.Request, sess *db.Session, botClient, userClient *worker.Client) (interface{}, error) {
+		if r.URL.Query().Get("fail") != "" {
+			return nil, fmt.Errorf("failed")
+		}
+		return sess.Username, nil
+	}
+	if err := srv.HandlePage("/greeting", Authenticated, "Greeting", greeting); err != nil {
+		t.Fatalf("failed to add page handler: %s", err.Error())
+	}
+
+	userSession := db.NewSession("test-token", 42)
+	userSession.Username = "user"
+	srv.db.InsertSession(userSession)
+
+	request := func(session *db.Session, route string, expectedStatus int) string {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", route, nil)
+		if session != nil {
+			req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", session.ID))
+		}
+		srv.web.Handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("GET %s returned wrong status code: got %v expected %v", route, status, expectedStatus)
+		}
+		return rr.Body.String()
+	}
+
+	if body := request(nil, "/hello", http.StatusOK); body != "hello guest" {
+		t.Errorf("unexpected public response without session: %s", body)
+	}
+	if body := request(userSession, "/hello", http.StatusOK); body != "hello user" {
+		t.Errorf("unexpected public response with session: %s", body)
+	}
+	request(nil, "/private", http.StatusFound)
+	if body := request(userSession, "/private", http.StatusOK); body != "hello user" {
+		t.Errorf("unexpected authenticated response: %s", body)
+	}
+	request(userSession, "/secret", http.StatusForbidden)
+
+	body := request(userSession, "/greeting", http.StatusOK)
+	if !strings.Contains(body, "<p>Greetings, user</p>") || !strings.Contains(body, "</html>") {
+		t.Errorf("page was not rendered in the layout: %s", body)
+	}
+	request(userSession, "/greeting?fail=1", http.StatusInternalServerError)
+}
+
+func TestForms(t *testing.T) {
+	f := new(form.Form)
+	f.Name = "Default form"
+	f.Pages = []form.Page{{Elements: []form.Element{{ID: "projname", Name: "project", Label: "Project"}}}}
+	srv, err := NewService(*f, nil, echoAction, Config{CookieName: "test-cookie", DetectDuplicates: true})
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	session := db.NewSession("test-token", 42)
+	srv.db.InsertSession(session)
+
+	request := func(method, route string, values url.Values, expectedStatus int) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, route, strings.NewReader(values.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", session.ID))
+		srv.web.Handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("%s %s returned wrong status code: got %v expected %v", method, route, status, expectedStatus)
+		}
+		return rr
+	}
+
+	// a single form is shown at the root
+	if body := request("GET", "/", nil, http.StatusOK).Body.String(); !strings.Contains(body, `action="/"`) {
+		t.Fatal("root does not show the default form")
+	}
+
+	moduleForm := form.Form{Name: "Add module", Description: "Adds a module to a project"}
+	moduleForm.Pages = []form.Page{{Elements: []form.Element{{ID: "modname", Name: "module", Label: "Module"}}}}
+	moduleAction := func(values map[string][]string, _, _ *worker.Client) ([]string, error) {
+		return []string{"module " + values["module"][0]}, nil
+	}
+	for _, name := range []string{DefaultForm, "", "Module", "add module", "-module"} {
+		if err := srv.AddForm(name, moduleForm, nil, moduleAction); err == nil {
+			t.Errorf("adding a form named %q succeeded", name)
+		}
+	}
+	if err := srv.AddForm("module", form.Form{}, nil, moduleAction); err == nil {
+		t.Error("adding an empty form succeeded")
+	}
+	if err := srv.AddForm("module", moduleForm, nil, nil); err == nil {
+		t.Error("adding a form without actions succeeded")
+	}
+	if err := srv.AddForm("module", moduleForm, nil, moduleAction); err != nil {
+		t.Fatalf("failed to add form: %s", err.Error())
+	}
+
+	// the root lists all forms
+	body := request("GET", "/", nil, http.StatusOK).Body.String()
+	for _, exp := range []string{`href="/forms/default">Default form`, `href="/forms/module">Add module`, "Adds a module to a project", `href="/log?form=module"`} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("form list does not contain %s", exp)
+		}
+	}
+	if body := request("GET", "/forms/default", nil, http.StatusOK).Body.String(); !strings.Contains(body, `action="/"`) {
+		t.Error("default form is not shown")
+	}
+	if body := request("GET", "/forms/module", nil, http.StatusOK).Body.String(); !strings.Contains(body, `action="/forms/module"`) || !strings.Contains(body, "Module") {
+		t.Error("named form is not shown")
+	}
+	request("GET", "/forms/missing", nil, http.StatusNotFound)
+	request("POST", "/forms/missing", url.Values{"module": {"m1"}}, http.StatusNotFound)
+
+	// jobs are tagged with their form, and identical values in another form
+	// are not duplicates
+	request("POST", "/", url.Values{"project": {"same"}, "module": {"same"}}, http.StatusSeeOther)
+	request("POST", "/forms/module", url.Values{"project": {"same"}, "module": {"same"}}, http.StatusSeeOther)
+	jobs, err := srv.db.GetUserFormJobs(42, "module")
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("unexpected jobs for form: %v %v", jobs, err)
+	}
+	if jobs[0].Label != "Add module: "+jobs[0].Fingerprint[:6] || jobs[0].ValueMap["project"] != nil {
+		t.Errorf("unexpected job for form: %s %v", jobs[0].Label, jobs[0].ValueMap)
+	}
+	if jobs, _ := srv.db.GetUserFormJobs(42, DefaultForm); len(jobs) != 1 {
+		t.Errorf("unexpected number of default form jobs: %d", len(jobs))
+	}
+	if body := request("GET", "/log?form=module", nil, http.StatusOK).Body.String(); strings.Count(body, `href="/log/`) != 2 {
+		t.Errorf("log is not filtered by form: %s", body)
+	}
+
+	// the job runs the action of its form
+	srv.worker.Start()
+	defer srv.worker.Stop()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		job, err := srv.db.GetJob(jobs[0].ID)
+		if err != nil {
+			t.Fatalf("failed to retrieve job: %s", err.Error())
+		}
+		if job.IsFinished() {
+			if len(job.Messages) != 1 || job.Messages[0] != "module same" {
+				t.Fatalf("job did not run the action of its form: %v", job.Messages)
+			}
+			// retries and resubmissions use the form of the job
+			if body := request("GET", fmt.Sprintf("/log/%d/edit", job.ID), nil, http.StatusOK).Body.String(); !strings.Contains(body, `action="/forms/module"`) {
+				t.Error("resubmission does not use the form of the job")
+			}
+			return
+		}
+	}
+	t.Fatal("job did not finish")
+}
+
+func TestLoginLimits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/user" && r.Header.Get("Authorization") == "token alice-token" {
+			w.Write([]byte(`{"id": 7, "login": "alice"}`))
+			return
+		}
+		if r.URL.Path == "/api/v1/user" && r.Header.Get("Authorization") == "token carol-token" {
+			w.Write([]byte(`{"id": 8, "login": "carol"}`))
+			return
+		}
+		if username, password, ok := r.BasicAuth(); ok && r.URL.Path == "/api/v1/users/"+username+"/tokens" && password == "correct" {
+			switch {
+			case username == "alice":
+				w.Write([]byte(`[{"name": "tonic", "sha1": "alice-token"}]`))
+			case r.Method == http.MethodPost:
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"name": "tonic", "sha1": "carol-token"}`))
+			default:
+				w.Write([]byte(`[]`))
+			}
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "invalid credentials"}`))
+	}))
+	defer ts.Close()
+
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{CookieName: "test-cookie", Admins: []string{"alice"}}
+	config.GIN.Web = ts.URL
+	config.Login.MaxFailures = 2
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+
+	login := func(username, password, remote string, expectedStatus int) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/login", strings.NewReader(url.Values{"username": {username}, "password": {password}}.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = remote
+		srv.web.Handler.ServeHTTP(rr, req)
+		if rr.Code != expectedStatus {
+			t.Fatalf("login of %s from %s returned wrong status code: got %v expected %v", username, remote, rr.Code, expectedStatus)
+		}
+		return rr
+	}
+
+	login("bob", "guess1", "10.0.0.1:1234", http.StatusUnauthorized)
+	login("bob", "guess2", "10.0.0.1:1234", http.StatusUnauthorized)
+	// the address and username are locked out
+	rr := login("bob", "guess3", "10.0.0.1:1234", http.StatusTooManyRequests)
+	if retry, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 61 {
+		t.Errorf("unexpected Retry-After: %q", rr.Header().Get("Retry-After"))
+	}
+	login("bob", "correct", "10.0.0.2:1234", http.StatusTooManyRequests)
+	login("alice", "correct", "10.0.0.1:1234", http.StatusTooManyRequests)
+	rr = login("alice", "correct", "10.0.0.2:1234", http.StatusFound)
+
+	// failures and lockouts are listed on the admin page
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rr = httptest.NewRecorder()
+	srv.web.Handler.ServeHTTP(rr, req)
+	body := rr.Body.String()
+	for _, exp := range []string{">10.0.0.1</td>", ">bob</td>", ">locked out</td>", ">invalid credentials</td>"} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("admin page does not contain %s", exp)
+		}
+	}
+	// two failures and the start of the lockout; refused logins are not
+	// recorded
+	if logins, err := srv.db.GetFailedLogins(10); err != nil || len(logins) != 3 {
+		t.Errorf("unexpected failed logins: %d %v", len(logins), err)
+	}
+
+	// the token created for a user without one is recorded in the audit log
+	login("carol", "correct", "10.0.0.3:1234", http.StatusFound)
+	entries, err := srv.db.GetAuditEntries(10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected audit entries: %+v %v", entries, err)
+	}
+	if entry := entries[0]; entry.UserID != 8 || entry.Actor != worker.AuditUser || entry.Method != http.MethodPost || entry.Endpoint != "/api/v1/users/carol/tokens" || !entry.Succeeded() {
+		t.Errorf("unexpected audit entry for created token: %+v", entry)
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	limiter := newLoginLimiter(loginPolicy{maxFailures: 2, window: 10 * time.Minute, lockout: time.Minute, maxLockout: 3 * time.Minute})
+	now := time.Now()
+	addr, user := addressKey("10.0.0.1"), usernameKey("Bob")
+	fail := func(now time.Time, keys ...string) bool {
+		if wait := limiter.begin(now, keys...); wait != 0 {
+			t.Fatalf("login refused: %s", wait)
+		}
+		return limiter.finish(now, true, keys...)
+	}
+
+	if fail(now, addr, user) {
+		t.Fatal("locked out after one failure")
+	}
+	if !fail(now, addr, user) {
+		t.Fatal("not locked out after two failures")
+	}
+	wait := limiter.begin(now, usernameKey("bob"))
+	if wait != time.Minute {
+		t.Fatalf("unexpected lockout: got %s expected %s", wait, time.Minute)
+	}
+	// the lockout doubles with every further failure after it ends up to
+	// the maximum
+	later := now
+	for _, expected := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		later = later.Add(wait)
+		fail(later, addr, user)
+		if wait = limiter.begin(later, usernameKey("bob")); wait != expected {
+			t.Fatalf("unexpected lockout: got %s expected %s", wait, expected)
+		}
+	}
+	if lockouts := limiter.lockouts(later); len(lockouts) != 2 || lockouts[0].Failures != 5 {
+		t.Fatalf("unexpected lockouts: %+v", lockouts)
+	}
+
+	// failures are forgotten after the window and the lockout
+	later = later.Add(30 * time.Minute)
+	fail(later, addr)
+	if wait := limiter.begin(later, addr); wait != 0 {
+		t.Fatalf("locked out after failures expired: %s", wait)
+	}
+	limiter.finish(later, false, addr)
+	if len(limiter.records) != 1 {
+		t.Fatalf("expired records were not removed: %d", len(limiter.records))
+	}
+
+	fail(later, addr)
+	limiter.reset(addr)
+	if wait := limiter.begin(later, addr); wait != 0 {
+		t.Fatalf("locked out after reset: %s", wait)
+	}
+	limiter.finish(later, false, addr)
+
+	// logins in progress count towards the limit
+	other := addressKey("10.0.0.2")
+	for idx := 0; idx < 2; idx++ {
+		if wait := limiter.begin(later, other); wait != 0 {
+			t.Fatalf("login %d refused: %s", idx, wait)
+		}
+	}
+	if wait := limiter.begin(later, other); wait != loginInFlightWait {
+		t.Fatalf("login allowed while the pending logins could reach the limit: %s", wait)
+	}
+	limiter.finish(later, false, other)
+	if wait := limiter.begin(later, other); wait != 0 {
+		t.Fatalf("login refused after a pending login succeeded: %s", wait)
+	}
+
+	limiter.setPolicy(loginPolicy{maxFailures: -1})
+	for idx := 0; idx < 10; idx++ {
+		fail(later, addr)
+	}
+	if wait := limiter.begin(later, addr); wait != 0 {
+		t.Fatalf("locked out without limit: %s", wait)
+	}
+}
+
+func TestConcurrentLogins(t *testing.T) {
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts++
+		lock.Unlock()
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "invalid credentials"}`))
+	}))
+	defer ts.Close()
+
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{CookieName: "test-cookie"}
+	config.GIN.Web = ts.URL
+	config.Login.MaxFailures = 2
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+
+	// concurrent guesses beyond the limit are refused without contacting
+	// the GIN server
+	const guesses = 6
+	codes := make(chan int, guesses)
+	for idx := 0; idx < guesses; idx++ {
+		go func(idx int) {
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/login", strings.NewReader(url.Values{"username": {"bob"}, "password": {fmt.Sprintf("guess%d", idx)}}.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req.RemoteAddr = "10.0.0.1:1234"
+			srv.web.Handler.ServeHTTP(rr, req)
+			codes <- rr.Code
+		}(idx)
+	}
+	counts := make(map[int]int)
+	for idx := 0; idx < guesses-2; idx++ {
+		counts[<-codes]++
+	}
+	close(release)
+	for idx := 0; idx < 2; idx++ {
+		counts[<-codes]++
+	}
+	if counts[http.StatusTooManyRequests] != guesses-2 || counts[http.StatusUnauthorized] != 2 {
+		t.Errorf("unexpected responses to concurrent logins: %v", counts)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if attempts != 2 {
+		t.Errorf("GIN server received %d logins, expected 2", attempts)
+	}
+}
+
+func TestAuditRoutes(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{CookieName: "test-cookie", Admins: []string{"admin"}}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	handler := srv.web.Handler
+
+	userSession := db.NewSession("test-token", 42)
+	userSession.Username = "user"
+	srv.db.InsertSession(userSession)
+	adminSession := db.NewSession("admin-token", 1)
+	adminSession.Username = "admin"
+	srv.db.InsertSession(adminSession)
+
+	srv.db.InsertAuditEntry(&db.AuditEntry{Time: time.Now(), UserID: 42, JobID: 12, Actor: worker.AuditBot, Method: "POST", Endpoint: "/api/v1/org/lab/repos", Status: 201})
+	srv.db.InsertAuditEntry(&db.AuditEntry{Time: time.Now(), UserID: 43, Actor: worker.AuditUser, Method: "DELETE", Endpoint: "/api/v1/repos/bob/data", Status: 403, Error: "=forbidden"})
+
+	request := func(session *db.Session, route string, expectedStatus int) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", route, nil)
+		if err != nil {
+			t.Errorf("failed to create request: %s", route)
+		}
+		req.Header.Add("Cookie", fmt.Sprintf("test-cookie=%s", session.ID))
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("GET %s returned wrong status code: got %v expected %v", route, status, expectedStatus)
+		}
+		return rr
+	}
+
+	request(userSession, "/admin/audit", http.StatusForbidden)
+	request(adminSession, "/admin/audit?job=abc", http.StatusBadRequest)
+
+	content := request(adminSession, "/admin", http.StatusOK).Body.String()
+	if !strings.Contains(content, "/api/v1/org/lab/repos") || !strings.Contains(content, `href="/log/12"`) {
+		t.Errorf("admin page does not list audit log entry")
+	}
+	if !strings.Contains(content, "forbidden") {
+		t.Errorf("admin page does not list error of audit log entry")
+	}
+
+	rr := request(adminSession, "/admin/audit", http.StatusOK)
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("unexpected content type of CSV export: %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 || lines[0] != strings.Join(auditCSVHeader, ",") {
+		t.Fatalf("unexpected CSV export:\n%s", rr.Body.String())
+	}
+	if !strings.Contains(lines[1], ",42,12,bot,POST,/api/v1/org/lab/repos,201,") || !strings.HasSuffix(lines[2], ",403,'=forbidden") {
+		t.Errorf("unexpected CSV export:\n%s", rr.Body.String())
+	}
+
+	rr = request(adminSession, "/admin/audit?format=json&user=43", http.StatusOK)
+	lines = strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"Endpoint":"/api/v1/repos/bob/data"`) {
+		t.Errorf("unexpected JSON export:\n%s", rr.Body.String())
+	}
 }
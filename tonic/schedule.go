@@ -0,0 +1,161 @@
+package tonic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/G-Node/tonic/tonic/worker"
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduledJob defines a job that runs periodically with fixed values as the
+// bot user of the service.
+type ScheduledJob struct {
+	// Name of the schedule.  Must be unique.  Jobs created by the schedule
+	// are labelled with it.
+	Name string
+	// Spec is a cron expression (minute, hour, day of month, month, day of
+	// week) or a predefined schedule such as "@daily" or "@every 6h".
+	Spec string
+	// Values are passed to the action in place of form values.
+	Values map[string][]string
+	// Action to run.  If nil, the PostAction of the service is used.
+	Action worker.PostAction `json:"-"`
+}
+
+// scheduleEntry is a registered ScheduledJob and its cron entry.
+type scheduleEntry struct {
+	ScheduledJob
+	entryID cron.EntryID
+	// fromConfig is set for jobs scheduled from the configuration, which are
+	// replaced when the configuration is reloaded.
+	fromConfig bool
+}
+
+// scheduleInfo describes a registered schedule for display.
+type scheduleInfo struct {
+	Name    string
+	Spec    string
+	Next    time.Time
+	Prev    time.Time
+	Default bool
+}
+
+// Schedule registers a job to run periodically according to its Spec.  Jobs
+// can be scheduled before or after the service is started, but they only run
+// while the service is running.
+func (srv *Tonic) Schedule(job ScheduledJob) error {
+	spec, err := parseSchedule(job)
+	if err != nil {
+		return err
+	}
+
+	srv.scheduleLock.Lock()
+	defer srv.scheduleLock.Unlock()
+	for _, existing := range srv.schedules {
+		if existing.Name == job.Name {
+			return fmt.Errorf("a job named %q is already scheduled", job.Name)
+		}
+	}
+	srv.addSchedule(job, spec, false)
+	return nil
+}
+
+// setConfigSchedules replaces the jobs scheduled from the configuration with
+// the given jobs.  Jobs scheduled with Schedule() are kept.  If any of the new
+// jobs is invalid, the schedules are not changed.
+func (srv *Tonic) setConfigSchedules(jobs []ScheduledJob) error {
+	srv.scheduleLock.Lock()
+	defer srv.scheduleLock.Unlock()
+
+	names := make(map[string]bool)
+	for _, existing := range srv.schedules {
+		if !existing.fromConfig {
+			names[existing.Name] = true
+		}
+	}
+	specs := make([]cron.Schedule, len(jobs))
+	for idx, job := range jobs {
+		spec, err := parseSchedule(job)
+		if err != nil {
+			return err
+		}
+		if names[job.Name] {
+			return fmt.Errorf("a job named %q is already scheduled", job.Name)
+		}
+		names[job.Name] = true
+		specs[idx] = spec
+	}
+
+	kept := make([]*scheduleEntry, 0, len(srv.schedules))
+	for _, existing := range srv.schedules {
+		if existing.fromConfig {
+			srv.cron.Remove(existing.entryID)
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	srv.schedules = kept
+	for idx, job := range jobs {
+		srv.addSchedule(job, specs[idx], true)
+	}
+	return nil
+}
+
+// parseSchedule checks that the job has a name and parses its Spec.
+func parseSchedule(job ScheduledJob) (cron.Schedule, error) {
+	if job.Name == "" {
+		return nil, fmt.Errorf("scheduled job has no name")
+	}
+	spec, err := cron.ParseStandard(job.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q for job %q: %v", job.Spec, job.Name, err)
+	}
+	return spec, nil
+}
+
+// addSchedule adds the job to the scheduler.  The scheduleLock must be held.
+func (srv *Tonic) addSchedule(job ScheduledJob, spec cron.Schedule, fromConfig bool) {
+	// copy values to avoid mutating them after they're scheduled
+	values := make(map[string][]string, len(job.Values))
+	for k, v := range job.Values {
+		values[k] = v
+	}
+	job.Values = values
+
+	entry := &scheduleEntry{ScheduledJob: job, fromConfig: fromConfig}
+	entry.entryID = srv.cron.Schedule(spec, cron.FuncJob(func() { srv.runScheduled(entry.ScheduledJob) }))
+	srv.schedules = append(srv.schedules, entry)
+	srv.log.Info("Scheduled job", "name", job.Name, "spec", job.Spec)
+}
+
+// runScheduled adds a new run of the scheduled job to the worker queue.
+func (srv *Tonic) runScheduled(sj ScheduledJob) {
+	label := fmt.Sprintf("Scheduled: %s", sj.Name)
+	j := srv.worker.NewBotJob(label, sj.Values, sj.Action)
+	j.Schedule = sj.Name
+	if err := srv.worker.Enqueue(j); err != nil {
+		srv.log.Error("Failed to enqueue scheduled job", "name", sj.Name, "error", err)
+		return
+	}
+	srv.log.Info("Scheduled job queued", "name", sj.Name, "job", j.ID)
+}
+
+// scheduleInfo returns the registered schedules with their next and previous
+// run times.
+func (srv *Tonic) scheduleInfo() []scheduleInfo {
+	srv.scheduleLock.Lock()
+	defer srv.scheduleLock.Unlock()
+	info := make([]scheduleInfo, 0, len(srv.schedules))
+	for _, entry := range srv.schedules {
+		cronEntry := srv.cron.Entry(entry.entryID)
+		info = append(info, scheduleInfo{
+			Name:    entry.Name,
+			Spec:    entry.Spec,
+			Next:    cronEntry.Next,
+			Prev:    cronEntry.Prev,
+			Default: entry.Action == nil,
+		})
+	}
+	return info
+}
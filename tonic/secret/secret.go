@@ -0,0 +1,50 @@
+// Package secret defines a string type for configuration values, such as
+// passwords and tokens, that must not appear in logs or other output.
+package secret
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// Redacted replaces the value of a non-empty String when it is formatted,
+// logged, or marshalled.
+const Redacted = "[REDACTED]"
+
+// String is a secret string value.  Formatting it with the fmt package,
+// logging it with slog, or marshalling it to JSON produces Redacted instead of
+// the value (or an empty string if the value is empty).  Use Reveal to get
+// the actual value.
+type String string
+
+// Reveal returns the secret value.
+func (s String) Reveal() string {
+	return string(s)
+}
+
+func (s String) redacted() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// String implements fmt.Stringer.
+func (s String) String() string {
+	return s.redacted()
+}
+
+// GoString implements fmt.GoStringer.
+func (s String) GoString() string {
+	return s.redacted()
+}
+
+// LogValue implements slog.LogValuer.
+func (s String) LogValue() slog.Value {
+	return slog.StringValue(s.redacted())
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s String) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.redacted())
+}
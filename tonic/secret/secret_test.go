@@ -0,0 +1,56 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedacted(t *testing.T) {
+	config := struct {
+		Username string
+		Password String
+	}{"bot", "hunter2"}
+
+	outputs := map[string]string{
+		"%v":  fmt.Sprintf("%v", config),
+		"%+v": fmt.Sprintf("%+v", config),
+		"%#v": fmt.Sprintf("%#v", config),
+		"%s":  fmt.Sprintf("%s", config.Password),
+	}
+	if data, err := json.Marshal(config); err != nil {
+		t.Fatalf("Failed to marshal configuration: %v", err)
+	} else {
+		outputs["json"] = string(data)
+	}
+	buf := new(bytes.Buffer)
+	slog.New(slog.NewTextHandler(buf, nil)).Info("config", "password", config.Password, "config", config)
+	outputs["slog"] = buf.String()
+	buf.Reset()
+	slog.New(slog.NewJSONHandler(buf, nil)).Info("config", "password", config.Password, "config", config)
+	outputs["slog json"] = buf.String()
+
+	for name, output := range outputs {
+		if strings.Contains(output, "hunter2") {
+			t.Errorf("Secret revealed in %s output: %s", name, output)
+		}
+		if !strings.Contains(output, Redacted) {
+			t.Errorf("Redacted value missing from %s output: %s", name, output)
+		}
+	}
+
+	if config.Password.Reveal() != "hunter2" {
+		t.Fatalf("Unexpected secret value: %q", config.Password.Reveal())
+	}
+
+	var decoded struct{ Password String }
+	if err := json.Unmarshal([]byte(`{"password": "hunter2"}`), &decoded); err != nil || decoded.Password.Reveal() != "hunter2" {
+		t.Fatalf("Failed to unmarshal secret: %v %q", err, decoded.Password.Reveal())
+	}
+	if String("").String() != "" {
+		t.Fatal("Empty secret not empty when formatted")
+	}
+}
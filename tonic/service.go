@@ -1,27 +1,151 @@
 package tonic
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/G-Node/tonic/tonic/db"
 	"github.com/G-Node/tonic/tonic/form"
+	"github.com/G-Node/tonic/tonic/i18n"
+	"github.com/G-Node/tonic/tonic/metrics"
+	"github.com/G-Node/tonic/tonic/notify"
+	"github.com/G-Node/tonic/tonic/secret"
+	"github.com/G-Node/tonic/tonic/tracing"
 	"github.com/G-Node/tonic/tonic/web"
 	"github.com/G-Node/tonic/tonic/worker"
 	"github.com/gogs/go-gogs-client"
+	"github.com/robfig/cron/v3"
 )
 
 // Config containing all the configuration values for a service.
 type Config struct {
+	// Name of the service.  Identifies the service in log messages (default:
+	// "tonic").
+	Name string
+	// Log configures the messages logged by the service.
+	Log struct {
+		// Level is the minimum level of logged messages: "debug", "info"
+		// (default), "warn", or "error".  Database queries are logged at
+		// debug level.
+		Level string
+		// Format of log messages: "text" (default) or "json".
+		Format string
+	}
+	// GIN configures the GIN server and the bot user that represents the
+	// service.  The bot authenticates with Token if it is set, or with
+	// Username and Password otherwise.
 	GIN struct {
 		Web      string
 		Git      string
 		Username string
-		Password string
+		Password secret.String
+		// Token is a pre-provisioned access token for the bot user.
+		Token secret.String
+	}
+	// Retry configures the retrying of jobs that fail with a
+	// worker.RetryableError.
+	Retry struct {
+		// Maximum number of times a job is run (default: 1, no retries).
+		MaxAttempts int
+		// Delay before the first retry in seconds.  The delay is doubled
+		// after every attempt.
+		Delay uint
+		// Upper bound for the delay between attempts in seconds (default:
+		// one day).
+		MaxDelay uint
+	}
+	// Queue configures the limits of the job queue.
+	Queue struct {
+		// Maximum number of jobs waiting in the queue (default: 100).
+		Capacity int
+		// Maximum number of unfinished jobs per user (0: no limit).
+		MaxUserJobs int
+	}
+	// Webhook configures the endpoint (/webhook) that receives events from
+	// the GIN server.
+	Webhook struct {
+		// Secret shared with the GIN server for signing events.  Events are
+		// only accepted if it is set.
+		Secret secret.String
+	}
+	// Notify configures the notifications sent when jobs finish.  More
+	// notifiers can be added in code with Tonic.AddNotifier().
+	Notify struct {
+		// Email notifications are sent if the SMTP Host is set.
+		Email notify.Email
+		// Webhooks lists URLs that receive the finished job as JSON.
+		Webhooks []notify.Webhook
+		// Issue comments are added if the Repository is set.
+		Issue notify.IssueComment
 	}
-	Port       uint16
+	// Login configures the protection of the login page against password
+	// guessing.  Failed logins are counted per client address and per
+	// username, and after MaxFailures failures within the Window, further
+	// logins from the address or for the username are refused for the
+	// Lockout duration, which doubles with every further failure up to
+	// MaxLockout.
+	Login struct {
+		// Number of failed logins allowed within the Window (default: 5;
+		// negative: no limit).
+		MaxFailures int
+		// Period in seconds in which failed logins are counted (default:
+		// 900).
+		Window uint
+		// Duration of the first lockout in seconds (default: 60).
+		Lockout uint
+		// Upper bound for the lockout duration in seconds (default: 3600).
+		MaxLockout uint
+	}
+	// Admins lists the GIN usernames of the users that can access the
+	// administration pages of the service.
+	Admins []string
+	// Tracing configures the export of OpenTelemetry traces of HTTP
+	// requests, jobs, and GIN API calls to an OTLP collector.
+	Tracing tracing.Config
+	// Schedules defines jobs that run periodically with fixed values as the
+	// bot user.  More jobs can be scheduled in code with Tonic.Schedule().
+	Schedules []ScheduledJob
+	// If DetectDuplicates is set, submitting the same values as an unfinished
+	// job of the same user shows the existing job instead of creating a new
+	// one.
+	DetectDuplicates bool
+	Port             uint16
+	// TLS enables HTTPS on Port with the given certificate and key, and
+	// optionally an HTTP to HTTPS redirect and HSTS.
+	TLS web.TLSConfig
+	// BasePath is the path under which the service is served when it is
+	// mounted below the root of a site by a reverse proxy (e.g.,
+	// "/tonic/labproject").
+	BasePath string
+	// TrustedProxies lists the addresses (IPs or CIDR ranges) of reverse
+	// proxies whose X-Forwarded-* headers are trusted.
+	TrustedProxies []string
+	// Theme defines the branding of the pages.  Unset values are taken from
+	// web.DefaultTheme, except for the logo link, which defaults to the
+	// GIN.Web server if set.
+	Theme web.Theme
+	// Locale configures the languages of the web UI.
+	Locale struct {
+		// Default is the language used when none of the languages accepted
+		// by the browser are available (default: "en").
+		Default string
+		// Catalogs lists JSON files with message catalogues that add
+		// languages or replace built-in translations (see
+		// i18n.Bundle.LoadFile).
+		Catalogs []string
+	}
+	// AssetsDir is an optional directory with static files that replace or
+	// add to the embedded assets served under /assets/ (e.g., a custom.css).
+	AssetsDir  string
 	CookieName string
 	DBPath     string
 }
@@ -32,9 +156,40 @@ type Tonic struct {
 	web    *web.Server
 	db     *db.Connection
 	worker *worker.Worker
-	log    *log.Logger
-	form   *form.Form
-	config *Config
+	log    *slog.Logger
+	// form and config can be replaced while the service is running (see
+	// Reload)
+	form   atomic.Pointer[form.Form]
+	config atomic.Pointer[Config]
+	// forms added with AddForm by name and their names in the order they
+	// were added
+	forms     map[string]*serviceForm
+	formNames []string
+	formsLock sync.RWMutex
+	// logins limits failed logins
+	logins *loginLimiter
+	// botCheck caches the readiness check of the bot client
+	botCheck botCheck
+	// submitLock serialises job submissions for detecting duplicates
+	submitLock sync.Mutex
+	// cron runs scheduled jobs
+	cron *cron.Cron
+	// schedules lists the registered scheduled jobs in registration order
+	schedules    []*scheduleEntry
+	scheduleLock sync.Mutex
+	// eventActions maps webhook event types to the actions that handle them
+	eventActions map[string]worker.EventAction
+	eventLock    sync.RWMutex
+	// stopTracing flushes and stops the trace exporter
+	stopTracing func(context.Context) error
+	// notifiers added in code (not from the configuration)
+	notifiers  []worker.Notifier
+	notifyLock sync.Mutex
+	// reloader returns the configuration and form when the service is
+	// reloaded, and reloadHooks are called after a successful reload
+	reloader    Reloader
+	reloadHooks []func()
+	reloadLock  sync.Mutex
 }
 
 // NewService creates a new Tonic with a given form and custom job action.
@@ -42,30 +197,58 @@ func NewService(webform form.Form, preAction worker.PreAction, postAction worker
 	srv := new(Tonic)
 
 	// Logger
-	srv.log = log.New(os.Stderr, "tonic: ", log.LstdFlags) // TODO: Support naming the service and use the name as a logger prefix
+	logger, err := newLogger(config, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	srv.log = logger
 
-	srv.config = &config
+	srv.config.Store(&config)
 	// DB
-	srv.log.Print("Initialising database")
+	srv.log.Info("Initialising database")
 	conn, err := db.New(config.DBPath)
 	if err != nil {
 		return nil, err
 	}
 	srv.db = conn
+	srv.db.SetLogger(srv.log)
 
 	// Worker
-	srv.log.Print("Initialising worker")
-	srv.worker = worker.New(srv.db)
+	srv.log.Info("Initialising worker")
+	srv.worker = worker.New(srv.db, config.Queue.Capacity)
 	// Share logger with worker
 	srv.worker.SetLogger(srv.log)
 
 	// Web server
-	srv.log.Print("Initialising web service")
+	srv.log.Info("Initialising web service")
 	srv.web = web.New(config.Port)
 	// Share logger with web service
 	srv.web.SetLogger(srv.log)
+	srv.web.SetBasePath(config.BasePath)
+	if err := srv.web.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if config.TLS.Enabled() {
+		if err := srv.web.SetTLS(config.TLS); err != nil {
+			return nil, err
+		}
+	}
+	bundle := i18n.NewBundle(config.Locale.Default)
+	for _, filename := range config.Locale.Catalogs {
+		if err := bundle.LoadFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	srv.web.SetBundle(bundle)
+
+	srv.eventActions = make(map[string]worker.EventAction)
+	srv.forms = make(map[string]*serviceForm)
+	srv.logins = newLoginLimiter(loginPolicyFromConfig(&config))
+
+	// Retry policy, queue limits, notifiers, and theme
+	srv.applyConfig(&config)
 
-	srv.log.Print("Setting up router")
+	srv.log.Info("Setting up router")
 	srv.setupWebRoutes()
 
 	// set form and func
@@ -73,25 +256,80 @@ func NewService(webform form.Form, preAction worker.PreAction, postAction worker
 	srv.SetPreAction(preAction)
 	srv.SetPostAction(postAction)
 
+	// Scheduler
+	srv.cron = cron.New()
+	if err := srv.setConfigSchedules(config.Schedules); err != nil {
+		return nil, err
+	}
+
 	return srv, nil
 }
 
+// newLogger returns a structured logger that writes to out with the level and
+// format set in the configuration.  Every message includes the service name.
+func newLogger(config Config, out io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if config.Log.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Log.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %v", config.Log.Level, err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(config.Log.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: should be \"text\" or \"json\"", config.Log.Format)
+	}
+
+	return slog.New(handler).With("service", config.serviceName()), nil
+}
+
+// serviceName returns the configured Name of the service or "tonic" if unset.
+func (config Config) serviceName() string {
+	if config.Name == "" {
+		return "tonic"
+	}
+	return config.Name
+}
+
 // SetLogger sets the logger instance for the tonic service and the included
-// worker queue and web service.  If unset the service defines its own logger
-// with the same configuration as the standard Logger and the prefix 'tonic: '.
-func (srv *Tonic) SetLogger(l *log.Logger) {
+// database connection, worker queue, and web service.  If unset the service
+// defines its own logger based on the Name and Log configuration values.
+func (srv *Tonic) SetLogger(l *slog.Logger) {
 	srv.log = l
+	srv.db.SetLogger(l)
 	srv.worker.SetLogger(l)
 	srv.web.SetLogger(l)
 }
 
 // login to configured GIN server as the bot user that represents this service
-// and attach a new authenticated gogs.Client to the service struct.
+// and attach a new authenticated gogs.Client to the service struct.  If an
+// access token is configured, it is checked and used directly.  Otherwise, the
+// first access token of the bot user is used (or a new one is created) with
+// the configured username and password.
 func (srv *Tonic) login() error {
-	username := srv.config.GIN.Username
-	password := srv.config.GIN.Password
+	config := srv.config.Load()
+	if token := config.GIN.Token.Reveal(); token != "" {
+		client := worker.NewClient(config.GIN.Web, config.GIN.Git, token)
+		if _, err := client.GetSelfInfo(); err != nil {
+			return fmt.Errorf("Failed to authenticate with access token: %v", err)
+		}
+		srv.worker.SetClient(client)
+		return nil
+	}
+
+	username := config.GIN.Username
+	password := config.GIN.Password.Reveal()
+	if username == "" || password == "" {
+		return fmt.Errorf("No credentials specified: Either GIN.Token or GIN.Username and GIN.Password should be set")
+	}
 
-	client := gogs.NewClient(srv.config.GIN.Web, "")
+	client := gogs.NewClient(config.GIN.Web, "")
 	tokens, err := client.ListAccessTokens(username, password)
 	if err != nil {
 		return err
@@ -106,82 +344,187 @@ func (srv *Tonic) login() error {
 			return err
 		}
 	}
-	srv.worker.SetClient(worker.NewClient(srv.config.GIN.Web, srv.config.GIN.Git, token.Sha1))
+	srv.worker.SetClient(worker.NewClient(config.GIN.Web, config.GIN.Git, token.Sha1))
 	return nil
 }
 
 // Start the service (worker and web server).
 func (srv *Tonic) Start() error {
-	if srv.form == nil || len(srv.form.Pages) == 0 {
+	config := srv.config.Load()
+	if webform := srv.form.Load(); webform == nil || len(webform.Pages) == 0 {
 		return fmt.Errorf("No form specified: nil or empty form is invalid")
 	}
 	if srv.worker.PostAction == nil && srv.worker.PreAction == nil {
 		return fmt.Errorf("No action specified: Either Pre or Post action should be set")
 	}
+	if err := srv.web.ParseTemplates(); err != nil {
+		return err
+	}
+	if srv.worker.PostAction == nil {
+		for _, entry := range srv.schedules {
+			if entry.Action == nil {
+				return fmt.Errorf("Scheduled job %q has no action and no Post action is set", entry.Name)
+			}
+		}
+	}
 
-	srv.log.Print("Starting worker")
-	srv.worker.Start()
-	srv.log.Print("Worker started")
-
-	srv.log.Print("Starting web service")
-	srv.web.Start()
-	srv.log.Print("Web server started")
-
-	if srv.config.GIN.Web != "" {
-		srv.log.Printf("Logging in to gin (%s)", srv.config.GIN.Web)
+	// Log in before starting anything so that a failed login doesn't leave
+	// the service half started
+	if config.GIN.Web != "" {
+		srv.log.Info("Logging in to gin", "server", config.GIN.Web)
 		if err := srv.login(); err != nil {
+			metrics.LoginFailures.WithLabelValues("bot").Inc()
+			srv.log.Error("Login failed", "server", config.GIN.Web, "error", err)
 			return err
 		}
-		srv.log.Print("Logged in and ready")
+		srv.log.Info("Logged in")
 	} else {
-		srv.log.Print("No server configured - skipping login and disabling login requirements")
-		srv.log.Print("WARNING: Authentication is open!")
+		srv.log.Info("No server configured - skipping login and disabling login requirements")
+		srv.log.Warn("Authentication is open!")
+	}
+
+	stopTracing, err := tracing.Setup(context.Background(), config.serviceName(), config.Tracing)
+	if err != nil {
+		return fmt.Errorf("Failed to set up tracing: %v", err)
+	}
+	srv.stopTracing = stopTracing
+	if config.Tracing.Endpoint != "" {
+		srv.log.Info("Exporting traces", "endpoint", config.Tracing.Endpoint)
+	}
+
+	srv.log.Info("Starting worker")
+	srv.worker.Start()
+	srv.log.Info("Worker started")
+
+	srv.log.Info("Starting web service")
+	if err := srv.web.Start(); err != nil {
+		srv.log.Error("Failed to start web server", "addr", srv.web.Addr, "error", err)
+		srv.worker.Stop()
+		srv.stopTracing(context.Background())
+		return err
 	}
+	srv.log.Info("Web server started", "addr", srv.web.Addr)
+
+	// Scheduled jobs run as the bot user so start them after login
+	srv.log.Info("Starting scheduler")
+	srv.cron.Start()
 	return nil
 }
 
-// WaitForInterrupt blocks until the service receives an interrupt signal (SIGINT).
+// WaitForInterrupt blocks until the service receives an interrupt signal
+// (SIGINT).  A hangup signal (SIGHUP) reloads the configuration and form
+// without stopping the service (see Reload()).
 func (srv *Tonic) WaitForInterrupt() {
 	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, os.Interrupt)
-	<-sigchan
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGHUP)
+	defer signal.Stop(sigchan)
+	for sig := range sigchan {
+		if sig != syscall.SIGHUP {
+			return
+		}
+		srv.log.Info("Reloading configuration")
+		if err := srv.Reload(); err != nil {
+			srv.log.Error("Reload failed", "error", err)
+		}
+	}
 }
 
-// Stop the service by gracefully shutting down the web service, stopping the
-// worker pool, and closing the database connection, in that order.
+// Stop the service by stopping the scheduler, gracefully shutting down the web
+// service, stopping the worker pool, and closing the database connection, in
+// that order.
 func (srv *Tonic) Stop() {
-	srv.log.Print("Stopping web service")
+	srv.log.Info("Stopping scheduler")
+	srv.cron.Stop()
+
+	srv.log.Info("Stopping web service")
 	srv.web.Stop()
 
-	srv.log.Print("Stopping worker queue")
+	srv.log.Info("Stopping worker queue")
 	srv.worker.Stop()
 
-	srv.log.Print("Closing database connection")
+	srv.log.Info("Closing database connection")
 	if err := srv.db.Close(); err != nil {
-		srv.log.Printf("Error closing database: %v", err)
+		srv.log.Error("Error closing database", "error", err)
 	}
-	srv.log.Print("Service stopped")
-}
 
-// SetForm can be used to set or override the form for the service.
-func (srv *Tonic) SetForm(webform form.Form) {
-	srv.form = new(form.Form)
-	// copy elements manually
-	srv.form.Name = webform.Name
-	srv.form.Description = webform.Description
-	srv.form.Pages = make([]form.Page, len(webform.Pages))
-	for pageIdx := range webform.Pages {
-		elements := make([]form.Element, len(webform.Pages[pageIdx].Elements))
-		copy(elements, webform.Pages[pageIdx].Elements)
-		// any element without a type will be set to text
-		for idx := range elements {
-			if elements[idx].Type == "" {
-				elements[idx].Type = form.TextInput
-			}
+	if srv.stopTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.stopTracing(ctx); err != nil {
+			srv.log.Error("Error flushing traces", "error", err)
 		}
-		srv.form.Pages[pageIdx].Elements = elements
-		srv.form.Pages[pageIdx].Description = webform.Pages[pageIdx].Description
 	}
+	srv.log.Info("Service stopped")
+}
+
+// AddNotifier adds a Notifier that is notified whenever a job finishes.
+func (srv *Tonic) AddNotifier(n worker.Notifier) {
+	srv.notifyLock.Lock()
+	defer srv.notifyLock.Unlock()
+	srv.notifiers = append(srv.notifiers, n)
+	srv.worker.AddNotifier(n)
+}
+
+// applyConfig applies the settings of the configuration that can change while
+// the service is running to the worker and web server: the retry policy, the
+// limit of unfinished jobs per user, the notifiers, the theme, and the login
+// limits.
+func (srv *Tonic) applyConfig(config *Config) {
+	theme := config.Theme
+	if theme.HomeURL == "" {
+		theme.HomeURL = config.GIN.Web
+	}
+	srv.web.SetTheme(theme.WithDefaults())
+	srv.logins.setPolicy(loginPolicyFromConfig(config))
+
+	srv.worker.SetMaxUserJobs(config.Queue.MaxUserJobs)
+	srv.worker.SetRetryPolicy(worker.RetryPolicy{
+		MaxAttempts: config.Retry.MaxAttempts,
+		Delay:       time.Duration(config.Retry.Delay) * time.Second,
+		MaxDelay:    time.Duration(config.Retry.MaxDelay) * time.Second,
+	})
+
+	notifiers := make([]worker.Notifier, 0)
+	if config.Notify.Email.Host != "" {
+		email := config.Notify.Email
+		notifiers = append(notifiers, &email)
+	}
+	for idx := range config.Notify.Webhooks {
+		webhook := config.Notify.Webhooks[idx]
+		notifiers = append(notifiers, &webhook)
+	}
+	if config.Notify.Issue.Repository != "" {
+		issue := config.Notify.Issue
+		notifiers = append(notifiers, &issue)
+	}
+	// keep the notifiers added in code
+	srv.notifyLock.Lock()
+	defer srv.notifyLock.Unlock()
+	srv.worker.SetNotifiers(append(notifiers, srv.notifiers...))
+}
+
+// SetForm can be used to set or override the form for the service (the
+// DefaultForm).  The form can be replaced while the service is running.
+func (srv *Tonic) SetForm(webform form.Form) {
+	srv.form.Store(normaliseForm(webform))
+}
+
+// SetTemplate replaces one of the page templates of the service (see
+// web.Server.SetTemplate).  It must be called before Start.
+func (srv *Tonic) SetTemplate(name, text string) error {
+	return srv.web.SetTemplate(name, text)
+}
+
+// AddPage adds a page template to the service (see web.Server.AddPage).  It
+// must be called before Start.
+func (srv *Tonic) AddPage(name, text string) error {
+	return srv.web.AddPage(name, text)
+}
+
+// AddCatalog adds a message catalogue for translating the pages and form of
+// the service (see web.Server.AddCatalog).  It must be called before Start.
+func (srv *Tonic) AddCatalog(c i18n.Catalog) {
+	srv.web.AddCatalog(c)
 }
 
 // SetPreAction can be used to set or override the custom pre-form submission action for the service.
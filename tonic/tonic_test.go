@@ -2,14 +2,19 @@ package tonic
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"sort"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/G-Node/tonic/tonic/db"
 	"github.com/G-Node/tonic/tonic/form"
 	"github.com/G-Node/tonic/tonic/worker"
 )
@@ -175,10 +180,8 @@ func TestLoggers(t *testing.T) {
 		t.Fatalf("Failed to initialise tonic service: %s", err.Error())
 	}
 
-	prefix := "[tonictest] "
-
 	lb := new(LogBuffer)
-	logger := log.New(lb, prefix, 0)
+	logger := slog.New(slog.NewTextHandler(lb, nil)).With("service", "tonictest")
 
 	srv.SetLogger(logger)
 
@@ -201,9 +204,235 @@ func TestLoggers(t *testing.T) {
 	}
 
 	for _, msg := range expMessages {
-		expmsg := fmt.Sprintf("%s%s", prefix, msg)
+		expmsg := fmt.Sprintf("msg=%q service=tonictest", msg)
 		if !strings.Contains(logstring, expmsg) {
 			log.Fatalf("Expected message %q not found in log", expmsg)
 		}
 	}
 }
+
+func TestLogConfig(t *testing.T) {
+	config := Config{Name: "testservice"}
+	config.Log.Format = "json"
+	config.Log.Level = "warn"
+
+	lb := new(LogBuffer)
+	logger, err := newLogger(config, lb)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	logger.Info("Not logged")
+	logger.Warn("Logged", "job", 42)
+
+	logstring := lb.String()
+	if strings.Contains(logstring, "Not logged") {
+		t.Fatalf("Message below the configured level logged: %s", logstring)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(logstring), &entry); err != nil {
+		t.Fatalf("Failed to parse JSON log entry %q: %v", logstring, err)
+	}
+	if entry["msg"] != "Logged" || entry["service"] != "testservice" || entry["job"] != float64(42) {
+		t.Fatalf("Unexpected log entry: %v", entry)
+	}
+
+	config.Log.Level = "verbose"
+	if _, err := newLogger(config, lb); err == nil {
+		t.Fatal("Expected error for invalid log level")
+	}
+	config.Log.Level = ""
+	config.Log.Format = "xml"
+	if _, err := newLogger(config, lb); err == nil {
+		t.Fatal("Expected error for invalid log format")
+	}
+}
+
+func TestScheduledJobs(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{}
+	config.Schedules = []ScheduledJob{{Name: "nightly", Spec: "0 3 * * *", Values: map[string][]string{"α": {"alpha"}}}}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("Failed to initialise tonic service: %s", err.Error())
+	}
+
+	if err := srv.Schedule(ScheduledJob{Name: "nightly", Spec: "@daily"}); err == nil {
+		t.Fatal("Scheduling a job with a duplicate name succeeded")
+	}
+	if err := srv.Schedule(ScheduledJob{Name: "broken", Spec: "every day"}); err == nil {
+		t.Fatal("Scheduling a job with an invalid spec succeeded")
+	}
+	if err := srv.Schedule(ScheduledJob{Spec: "@daily"}); err == nil {
+		t.Fatal("Scheduling a job without a name succeeded")
+	}
+	audit := func(values map[string][]string, _, _ *worker.Client) ([]string, error) {
+		return []string{"audited"}, nil
+	}
+	if err := srv.Schedule(ScheduledJob{Name: "audit", Spec: "@every 1h", Action: audit}); err != nil {
+		t.Fatalf("Failed to schedule job: %s", err.Error())
+	}
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start tonic service: %s", err.Error())
+	}
+	defer srv.Stop()
+
+	info := srv.scheduleInfo()
+	if len(info) != 2 || info[0].Name != "nightly" || info[1].Name != "audit" {
+		t.Fatalf("Unexpected schedules: %+v", info)
+	}
+	if info[1].Next.IsZero() {
+		t.Fatal("Scheduled job has no next run time")
+	}
+
+	// run each schedule once instead of waiting for them
+	for _, entry := range srv.schedules {
+		srv.runScheduled(entry.ScheduledJob)
+	}
+
+	var runs []db.Job
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		runs, err = srv.db.GetScheduledJobs(10)
+		if err != nil {
+			t.Fatalf("Failed to retrieve scheduled jobs: %s", err.Error())
+		}
+		if len(runs) == 2 && !runs[0].EndTime.IsZero() && !runs[1].EndTime.IsZero() {
+			break
+		}
+	}
+	if len(runs) != 2 {
+		t.Fatalf("Unexpected number of scheduled runs: %d (expected 2)", len(runs))
+	}
+	// newest first
+	if runs[0].Schedule != "audit" || runs[0].Messages[0] != "audited" {
+		t.Fatalf("Unexpected scheduled run: %s %v", runs[0].Schedule, runs[0].Messages)
+	}
+	if runs[1].Schedule != "nightly" || runs[1].Messages[0] != "α:alpha" {
+		t.Fatalf("Unexpected scheduled run: %s %v", runs[1].Schedule, runs[1].Messages)
+	}
+}
+
+func TestLoginWithToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/user" || r.Header.Get("Authorization") != "token valid-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 7, "login": "bot"}`))
+	}))
+	defer ts.Close()
+
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{}
+	config.GIN.Web = ts.URL
+	srv, err := NewService(*f, nil, noopAction, config)
+	if err != nil {
+		t.Fatalf("Failed to initialise tonic service: %s", err.Error())
+	}
+	defer srv.db.Close()
+
+	if err := srv.login(); err == nil {
+		t.Fatal("Login succeeded without credentials")
+	}
+
+	srv.config.Load().GIN.Token = "invalid-token"
+	if err := srv.login(); err == nil {
+		t.Fatal("Login succeeded with invalid token")
+	}
+
+	srv.config.Load().GIN.Token = "valid-token"
+	if err := srv.login(); err != nil {
+		t.Fatalf("Login with valid token failed: %v", err)
+	}
+	if user, err := srv.worker.Client().GetSelfInfo(); err != nil || user.Login != "bot" {
+		t.Fatalf("Bot client not authenticated with token: %v", err)
+	}
+
+	// the token never appears in the log
+	lb := new(LogBuffer)
+	srv.SetLogger(slog.New(slog.NewTextHandler(lb, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	srv.log.Info("Configuration", "config", srv.config.Load())
+	if strings.Contains(lb.String(), "valid-token") {
+		t.Fatalf("Token found in log: %s", lb.String())
+	}
+}
+
+func TestReload(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{Port: 3000, Admins: []string{"alice"}}
+	config.Schedules = []ScheduledJob{{Name: "nightly", Spec: "0 3 * * *"}}
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("Failed to initialise tonic service: %s", err.Error())
+	}
+	if err := srv.Schedule(ScheduledJob{Name: "audit", Spec: "@every 1h"}); err != nil {
+		t.Fatalf("Failed to schedule job: %s", err.Error())
+	}
+
+	if err := srv.Reload(); err == nil {
+		t.Fatal("Reload without a reloader succeeded")
+	}
+
+	newForm := form.Form{Name: "Reloaded", Pages: []form.Page{{Elements: []form.Element{{Name: "new"}}}}}
+	newConfig := Config{Port: 4000, Admins: []string{"bob"}}
+	newConfig.Schedules = []ScheduledJob{{Name: "weekly", Spec: "@weekly"}}
+	srv.SetReloader(func() (Config, form.Form, error) {
+		return newConfig, newForm, nil
+	})
+	var reloads int
+	srv.OnReload(func() { reloads++ })
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("Reload failed: %s", err.Error())
+	}
+	if reloads != 1 {
+		t.Fatalf("OnReload function called %d times after reload", reloads)
+	}
+
+	if name := srv.form.Load().Name; name != "Reloaded" {
+		t.Fatalf("Form was not replaced: %q", name)
+	}
+	if el := srv.form.Load().Pages[0].Elements[0]; el.Type != form.TextInput {
+		t.Fatalf("Reloaded form element has unexpected type %q", el.Type)
+	}
+	cfg := srv.config.Load()
+	if len(cfg.Admins) != 1 || cfg.Admins[0] != "bob" {
+		t.Fatalf("Admins were not replaced: %v", cfg.Admins)
+	}
+	if cfg.Port != 3000 {
+		t.Fatalf("Port changed on reload: %d", cfg.Port)
+	}
+	info := srv.scheduleInfo()
+	if len(info) != 2 || info[0].Name != "audit" || info[1].Name != "weekly" {
+		t.Fatalf("Unexpected schedules after reload: %+v", info)
+	}
+
+	// invalid configurations leave the service unchanged
+	newConfig.Schedules = []ScheduledJob{{Name: "audit", Spec: "@daily"}}
+	newConfig.Admins = nil
+	if err := srv.Reload(); err == nil {
+		t.Fatal("Reload with a duplicate schedule name succeeded")
+	}
+	newConfig.Schedules = nil
+	srv.SetReloader(func() (Config, form.Form, error) {
+		return newConfig, form.Form{}, nil
+	})
+	if err := srv.Reload(); err == nil {
+		t.Fatal("Reload with an empty form succeeded")
+	}
+	srv.SetReloader(func() (Config, form.Form, error) {
+		return Config{}, form.Form{}, fmt.Errorf("broken file")
+	})
+	if err := srv.Reload(); err == nil {
+		t.Fatal("Reload with a failing reloader succeeded")
+	}
+	if len(srv.config.Load().Admins) != 1 || len(srv.scheduleInfo()) != 2 {
+		t.Fatal("Failed reload changed the configuration")
+	}
+	if reloads != 1 {
+		t.Fatalf("OnReload function called after failed reloads: %d calls", reloads)
+	}
+}
@@ -0,0 +1,101 @@
+// Package tracing configures the OpenTelemetry tracer provider for Tonic
+// services and provides helpers for carrying traces through jobs.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer used for all Tonic spans.
+const Name = "github.com/G-Node/tonic"
+
+// Config for exporting traces.
+type Config struct {
+	// Endpoint of the OTLP/HTTP collector (host:port, e.g.,
+	// "localhost:4318").  Tracing is disabled if empty.
+	Endpoint string
+	// Insecure disables TLS for the connection to the collector.
+	Insecure bool
+	// SampleRatio is the fraction of traces that are sampled (0 < ratio <= 1).
+	// All traces are sampled if it is zero.
+	SampleRatio float64
+}
+
+// Setup installs a global tracer provider that exports spans to the
+// configured OTLP collector under the given service name, and the W3C trace
+// context propagator.  The returned function flushes and stops the exporter.
+// If no endpoint is configured, tracing is disabled and the returned function
+// does nothing.
+func Setup(ctx context.Context, serviceName string, cfg Config) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+	res := resource.NewSchemaless(semconv.ServiceName(serviceName))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for all Tonic spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// IDs returns the hex encoded trace and span IDs of the span in the given
+// context.  Both are empty if the context has no valid, sampled span.
+func IDs(ctx context.Context) (traceID, spanID string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
+
+// ContextWithIDs returns a context with a remote parent span built from the
+// given hex encoded trace and span IDs, so that spans started from it are
+// part of the original trace.  The context is returned unchanged if the IDs
+// are invalid.
+func ContextWithIDs(ctx context.Context, traceID, spanID string) context.Context {
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		return ctx
+	}
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		return ctx
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
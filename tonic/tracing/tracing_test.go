@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestContextWithIDs(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	traceID, spanID := IDs(ctx)
+	if traceID != span.SpanContext().TraceID().String() || spanID != span.SpanContext().SpanID().String() {
+		t.Fatalf("Unexpected IDs %q/%q for span %v", traceID, spanID, span.SpanContext())
+	}
+
+	_, child := provider.Tracer("test").Start(ContextWithIDs(context.Background(), traceID, spanID), "child")
+	defer child.End()
+	if child.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Fatal("Span started from restored context is not part of the original trace")
+	}
+	if parent := child.(sdktrace.ReadOnlySpan).Parent(); parent.SpanID() != span.SpanContext().SpanID() {
+		t.Fatal("Span started from restored context is not a child of the original span")
+	}
+
+	if traceID, spanID := IDs(context.Background()); traceID != "" || spanID != "" {
+		t.Fatalf("Expected empty IDs for context without span: %q/%q", traceID, spanID)
+	}
+	ctx = context.Background()
+	if ContextWithIDs(ctx, "", "") != ctx {
+		t.Fatal("Context modified for empty IDs")
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "test", Config{})
+	if err != nil {
+		t.Fatalf("Setup failed without endpoint: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AssetCacheControl is the Cache-Control header sent with static assets.
+// Clients revalidate assets with their ETag after an hour.
+const AssetCacheControl = "public, max-age=3600"
+
+// assetHandler serves static files from an optional override directory,
+// falling back to the embedded files.
+type assetHandler struct {
+	embedded fs.FS
+	override fs.FS
+	// etags caches the content hashes of embedded files by name
+	etags sync.Map
+}
+
+// AssetHandler returns a handler that serves the files in embedded, or the
+// file with the same name in overrideDir if it exists (e.g., a custom.css or
+// logo for branding).  The request path is the file name (use it with
+// http.StripPrefix).  Responses include an ETag and Cache-Control header, and
+// conditional requests are answered with 304 Not Modified.  Directories are
+// not listed.
+func AssetHandler(embedded fs.FS, overrideDir string) http.Handler {
+	ah := &assetHandler{embedded: embedded}
+	if overrideDir != "" {
+		ah.override = os.DirFS(overrideDir)
+	}
+	return ah
+}
+
+func (ah *assetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if !fs.ValidPath(name) || name == "." {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, etag, modtime, err := ah.open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to read asset", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "failed to read asset", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", AssetCacheControl)
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, name, modtime, content)
+}
+
+// open returns the named file from the override directory if it exists there
+// or from the embedded files, with its ETag and modification time.
+func (ah *assetHandler) open(name string) (fs.File, string, time.Time, error) {
+	if ah.override != nil {
+		file, info, err := openFile(ah.override, name)
+		if err == nil {
+			// hashing the file on every request is too costly; the size and
+			// modification time identify the version well enough
+			etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+			return file, etag, info.ModTime(), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", time.Time{}, err
+		}
+	}
+
+	file, info, err := openFile(ah.embedded, name)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	etag, err := ah.embeddedETag(name)
+	if err != nil {
+		file.Close()
+		return nil, "", time.Time{}, err
+	}
+	return file, etag, info.ModTime(), nil
+}
+
+// embeddedETag returns the ETag of an embedded file, computed from its
+// content the first time it is requested.
+func (ah *assetHandler) embeddedETag(name string) (string, error) {
+	if etag, ok := ah.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	content, err := fs.ReadFile(ah.embedded, name)
+	if err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(content))
+	ah.etags.Store(name, etag)
+	return etag, nil
+}
+
+// openFile opens the named regular file in fsys.  Directories are reported as
+// not existing.
+func openFile(fsys fs.FS, name string) (fs.File, fs.FileInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+	return file, info, nil
+}
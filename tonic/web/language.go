@@ -0,0 +1,72 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/G-Node/tonic/tonic/i18n"
+)
+
+// LanguageCookie is the name of the cookie that stores the language chosen by
+// the user.
+const LanguageCookie = "tonic-lang"
+
+// SetBundle sets the message catalogues used to translate the pages.  The
+// templates are parsed for each language of the bundle.  It must be called
+// before Start.
+func (ws *Server) SetBundle(b *i18n.Bundle) {
+	ws.tmplLock.Lock()
+	defer ws.tmplLock.Unlock()
+	ws.bundle = b
+	ws.pages = nil
+}
+
+// AddCatalog adds a message catalogue to the bundle (see i18n.Bundle.Add).
+// It must be called before Start.
+func (ws *Server) AddCatalog(c i18n.Catalog) {
+	ws.tmplLock.Lock()
+	defer ws.tmplLock.Unlock()
+	ws.bundle.Add(c)
+	ws.pages = nil
+}
+
+// Bundle returns the message catalogues used to translate the pages.
+func (ws *Server) Bundle() *i18n.Bundle {
+	return ws.bundle
+}
+
+// Locale returns the catalogue for the language of the request: the language
+// chosen with the "lang" query parameter or stored in the LanguageCookie, or
+// the best match for the Accept-Language header, or the default language.
+func (ws *Server) Locale(r *http.Request) *i18n.Catalog {
+	if r == nil {
+		return ws.bundle.Default()
+	}
+	if c := ws.bundle.Lookup(r.URL.Query().Get("lang")); c != nil {
+		return c
+	}
+	if cookie, err := r.Cookie(LanguageCookie); err == nil {
+		if c := ws.bundle.Lookup(cookie.Value); c != nil {
+			return c
+		}
+	}
+	return ws.bundle.Match(r.Header.Get("Accept-Language"))
+}
+
+// language is a middleware that stores the language chosen with the "lang"
+// query parameter in the LanguageCookie, so that it is used for the following
+// requests.
+func (ws *Server) language(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := ws.bundle.Lookup(r.URL.Query().Get("lang")); c != nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:     LanguageCookie,
+				Value:    c.Language,
+				Path:     ws.URL("/"),
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// SetBasePath sets the path under which the service is served (e.g.,
+// "/tonic/labproject" for https://gin.example.org/tonic/labproject/).  Routes
+// are registered without the base path; it is removed from request paths
+// before routing and added to links with URL().  Requests outside the base
+// path are not found.  It must be called before Start.
+func (ws *Server) SetBasePath(path string) {
+	path = strings.Trim(path, "/")
+	if path != "" {
+		path = "/" + path
+	}
+	ws.basePath = path
+}
+
+// BasePath returns the path under which the service is served without a
+// trailing slash, or an empty string if it is served at the root.
+func (ws *Server) BasePath() string {
+	return ws.basePath
+}
+
+// URL returns the given absolute service path (e.g., "/log") prefixed with the
+// base path, for use in links, redirects, and cookies.
+func (ws *Server) URL(path string) string {
+	return ws.basePath + path
+}
+
+// stripBasePath is a middleware that removes the base path from the request
+// path before routing.  The base path without a trailing slash is redirected
+// to the root of the service.
+func (ws *Server) stripBasePath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ws.basePath == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == ws.basePath {
+			http.Redirect(w, r, ws.basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, ws.basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		http.StripPrefix(ws.basePath, next).ServeHTTP(w, r)
+	})
+}
+
+// SetTrustedProxies sets the addresses (IPs or CIDR ranges) of reverse
+// proxies whose X-Forwarded-For, X-Forwarded-Host, and X-Forwarded-Proto
+// headers are trusted.  The headers of requests from any other address are
+// ignored.  It must be called before Start.
+func (ws *Server) SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy address %q", proxy)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			} else {
+				ip = ip.To4()
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy address %q: %v", proxy, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	ws.trustedProxies = nets
+	return nil
+}
+
+// isTrusted returns true if the given address (with or without port) belongs
+// to a trusted proxy.
+func (ws *Server) isTrusted(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range ws.trustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded is a middleware that applies the X-Forwarded-* headers of
+// requests from trusted proxies: the client address (RemoteAddr) is the last
+// untrusted address in X-Forwarded-For, the Host is taken from
+// X-Forwarded-Host, and the scheme (see IsSecure()) from X-Forwarded-Proto.
+func (ws *Server) forwarded(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(ws.trustedProxies) == 0 || !ws.isTrusted(r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			hops := strings.Split(strings.Join(xff, ","), ",")
+			for idx := len(hops) - 1; idx >= 0; idx-- {
+				hop := strings.TrimSpace(hops[idx])
+				if hop == "" {
+					continue
+				}
+				r.RemoteAddr = hop
+				if !ws.isTrusted(hop) {
+					break
+				}
+			}
+		}
+		if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+			r.Host = host
+		}
+		if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsSecure returns true if the request was received over HTTPS, either
+// directly or through a trusted proxy.
+func IsSecure(r *http.Request) bool {
+	return r.TLS != nil || r.URL.Scheme == "https"
+}
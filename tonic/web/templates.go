@@ -0,0 +1,192 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/G-Node/tonic/templates"
+	"github.com/G-Node/tonic/tonic/i18n"
+)
+
+// Names of the built-in page templates, which can be replaced with
+// SetTemplate.
+const (
+	LayoutTemplate  = "Layout"
+	FormTemplate    = "Form"
+	FormsTemplate   = "Forms"
+	LogViewTemplate = "LogView"
+	LoginTemplate   = "Login"
+	FailTemplate    = "Fail"
+	AdminTemplate   = "Admin"
+)
+
+// defaultTemplates returns the built-in page templates by name.
+func defaultTemplates() map[string]string {
+	return map[string]string{
+		LayoutTemplate:  templates.Layout,
+		FormTemplate:    templates.Form,
+		FormsTemplate:   templates.Forms,
+		LogViewTemplate: templates.LogView,
+		LoginTemplate:   templates.Login,
+		FailTemplate:    templates.Fail,
+		AdminTemplate:   templates.Admin,
+	}
+}
+
+// NewTemplate returns a new template with the given name and the functions
+// available to all page templates in the default language (see
+// newTemplate).
+func (ws *Server) NewTemplate(name string) *template.Template {
+	return ws.newTemplate(name, ws.bundle.Default())
+}
+
+// newTemplate returns a new template with the given name and the functions
+// available to all page templates:
+//
+//	url: prefixes an absolute service path with the base path (see URL())
+//	theme: returns the branding of the service (see Theme())
+//	T: translates a message to the language (see i18n.Catalog.T)
+//	formatTime: formats a timestamp for the language
+//	lang: returns the catalogue of the language
+//	languages: returns the catalogues of all available languages
+func (ws *Server) newTemplate(name string, catalog *i18n.Catalog) *template.Template {
+	return template.New(name).Funcs(template.FuncMap{
+		"url":        ws.URL,
+		"theme":      ws.Theme,
+		"T":          catalog.T,
+		"formatTime": catalog.FormatTime,
+		"lang":       func() *i18n.Catalog { return catalog },
+		"languages":  ws.bundle.Catalogs,
+	})
+}
+
+// SetTemplate replaces one of the built-in page templates (LayoutTemplate,
+// FormTemplate, FormsTemplate, LogViewTemplate, LoginTemplate, FailTemplate,
+// or AdminTemplate) with the given template text.  The Layout template must
+// define "layout" and include the "content" template, which every other
+// template must define.  An error is returned if the name is unknown or the
+// template can't be parsed.  It must be called before Start.
+func (ws *Server) SetTemplate(name, text string) error {
+	ws.tmplLock.Lock()
+	defer ws.tmplLock.Unlock()
+	if _, ok := defaultTemplates()[name]; !ok {
+		return fmt.Errorf("unknown template %q", name)
+	}
+	return ws.setTemplate(name, text)
+}
+
+// AddPage adds a page template with the given name, which is rendered inside
+// the Layout with Render.  The template must define "content".  An error is
+// returned if a template with the same name exists or the template can't be
+// parsed.  It must be called before Start.
+func (ws *Server) AddPage(name, text string) error {
+	ws.tmplLock.Lock()
+	defer ws.tmplLock.Unlock()
+	if _, ok := ws.templates[name]; ok {
+		return fmt.Errorf("a template named %q already exists", name)
+	}
+	return ws.setTemplate(name, text)
+}
+
+// setTemplate checks the syntax of the template and stores it.  The parsed
+// templates are discarded and parsed again when needed.  The tmplLock must be
+// held.
+func (ws *Server) setTemplate(name, text string) error {
+	if _, err := ws.NewTemplate(name).Parse(text); err != nil {
+		return fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	ws.templates[name] = text
+	ws.pages = nil
+	return nil
+}
+
+// TemplateText returns the text of the named template.
+func (ws *Server) TemplateText(name string) string {
+	ws.tmplLock.Lock()
+	defer ws.tmplLock.Unlock()
+	return ws.templates[name]
+}
+
+// ParseTemplates parses the Layout and every page template combined with it.
+// An error is returned if any of the templates is invalid or doesn't define
+// the "layout" or "content" template.  Start parses the templates, so
+// template errors are reported when the service starts.
+func (ws *Server) ParseTemplates() error {
+	ws.tmplLock.Lock()
+	defer ws.tmplLock.Unlock()
+	return ws.parseTemplates()
+}
+
+// parseTemplates parses all the templates once for each language, with the
+// template functions of the language.  The tmplLock must be held.
+func (ws *Server) parseTemplates() error {
+	pages := make(map[string]map[string]*template.Template)
+	for _, catalog := range ws.bundle.Catalogs() {
+		layout, err := ws.newTemplate(LayoutTemplate, catalog).Parse(ws.templates[LayoutTemplate])
+		if err != nil {
+			return fmt.Errorf("parsing %s template: %v", LayoutTemplate, err)
+		}
+		if layout.Lookup("layout") == nil {
+			return fmt.Errorf("%s template does not define \"layout\"", LayoutTemplate)
+		}
+
+		langPages := make(map[string]*template.Template, len(ws.templates))
+		for name, text := range ws.templates {
+			if name == LayoutTemplate {
+				continue
+			}
+			page, err := layout.Clone()
+			if err != nil {
+				return err
+			}
+			if _, err := page.Parse(text); err != nil {
+				return fmt.Errorf("parsing %s template: %v", name, err)
+			}
+			if page.Lookup("content") == nil {
+				return fmt.Errorf("%s template does not define \"content\"", name)
+			}
+			langPages[name] = page
+		}
+		pages[catalog.Language] = langPages
+	}
+	ws.pages = pages
+	return nil
+}
+
+// page returns the named page template for the language, parsing all
+// templates first if necessary.
+func (ws *Server) page(name string, catalog *i18n.Catalog) (*template.Template, error) {
+	ws.tmplLock.Lock()
+	defer ws.tmplLock.Unlock()
+	if ws.pages == nil {
+		if err := ws.parseTemplates(); err != nil {
+			return nil, err
+		}
+	}
+	page, ok := ws.pages[catalog.Language][name]
+	if !ok {
+		return nil, fmt.Errorf("unknown page template %q", name)
+	}
+	return page, nil
+}
+
+// Render renders the named page template inside the Layout with the given
+// data in the language of the request (see Locale) and writes it with the
+// given status code.  Nothing is written if rendering fails, so the caller
+// can respond with an error page instead.
+func (ws *Server) Render(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) error {
+	page, err := ws.page(name, ws.Locale(r))
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := page.ExecuteTemplate(buf, "layout", data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	return err
+}
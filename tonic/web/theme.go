@@ -0,0 +1,103 @@
+package web
+
+// Link is a named link shown in the page footer.
+type Link struct {
+	Name string
+	URL  string
+}
+
+// Colors of the page elements as CSS colour values (e.g., "#2854a4").  Empty
+// values keep the colours of the stylesheet.
+type Colors struct {
+	// Primary colour of links and buttons.
+	Primary string
+	// Header is the background colour of the menu bar.
+	Header string
+	// Footer is the background colour of the page footer.
+	Footer string
+}
+
+// Theme defines the branding shown in the page layout.  Empty fields are
+// replaced with the values of DefaultTheme by WithDefaults.
+type Theme struct {
+	// Title of the pages.
+	Title string
+	// Description of the service used in page metadata.
+	Description string
+	// Logo is the URL of the image shown in the menu bar.
+	Logo string
+	// Favicon is the URL of the page icon.
+	Favicon string
+	// HomeURL is the target of the logo link, usually the GIN server.
+	HomeURL string
+	// Twitter is the account named in the page metadata (e.g., "@gnode").
+	Twitter string
+	// FooterLogo is the URL of the image shown next to the FooterText.
+	FooterLogo string
+	// FooterText is shown in the page footer.
+	FooterText string
+	// Links shown in the page footer.
+	Links []Link
+	// Colors of the page elements.
+	Colors Colors
+}
+
+// DefaultTheme returns the G-Node GIN branding used when a service doesn't
+// configure its own.
+func DefaultTheme() Theme {
+	wiki := "https://gindata.biologie.hu-berlin.de/G-Node/Info/wiki/"
+	return Theme{
+		Title:       "TONIC Project administration",
+		Description: "G-Node GIN Validation service",
+		Logo:        "https://gindata.biologie.hu-berlin.de/img/favicon.png",
+		Favicon:     "https://gindata.biologie.hu-berlin.de/img/favicon.png",
+		HomeURL:     "https://gindata.biologie.hu-berlin.de",
+		Twitter:     "@gnode",
+		FooterLogo:  "https://projects.g-node.org/assets/gnode-bootstrap-theme/1.2.0-snapshot/img/gnode-icon-50x50-transparent.png",
+		FooterText:  "© tonic team 2022",
+		Links: []Link{
+			{Name: "About", URL: wiki + "about"},
+			{Name: "Imprint", URL: wiki + "imprint"},
+			{Name: "Contact", URL: wiki + "contact"},
+			{Name: "Terms of Use", URL: wiki + "Terms+of+Use"},
+			{Name: "Datenschutz", URL: wiki + "Datenschutz"},
+		},
+	}
+}
+
+// WithDefaults returns a copy of the theme with empty fields set from
+// DefaultTheme.  Colors are not defaulted.
+func (t Theme) WithDefaults() Theme {
+	def := DefaultTheme()
+	set := func(value *string, fallback string) {
+		if *value == "" {
+			*value = fallback
+		}
+	}
+	set(&t.Title, def.Title)
+	set(&t.Description, def.Description)
+	set(&t.Logo, def.Logo)
+	set(&t.Favicon, def.Favicon)
+	set(&t.HomeURL, def.HomeURL)
+	set(&t.Twitter, def.Twitter)
+	set(&t.FooterLogo, def.FooterLogo)
+	set(&t.FooterText, def.FooterText)
+	if t.Links == nil {
+		t.Links = def.Links
+	}
+	return t
+}
+
+// SetTheme sets the branding shown in the page layout.  The theme can be
+// replaced while the server is running.
+func (ws *Server) SetTheme(t Theme) {
+	ws.theme.Store(&t)
+}
+
+// Theme returns the branding shown in the page layout.
+func (ws *Server) Theme() Theme {
+	if t := ws.theme.Load(); t != nil {
+		return *t
+	}
+	return DefaultTheme()
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TLSConfig for serving HTTPS.
+type TLSConfig struct {
+	// CertFile and KeyFile are the paths to the PEM encoded certificate
+	// (chain) and private key.  TLS is disabled if both are empty.  The files
+	// are loaded again when they change, so renewed certificates are used
+	// without restarting the service.
+	CertFile string
+	KeyFile  string
+	// RedirectPort is the port of a plain HTTP listener that redirects all
+	// requests to HTTPS (e.g., 80).  No redirect listener is started if zero.
+	RedirectPort uint16
+	// HSTSMaxAge is the max-age in seconds of the Strict-Transport-Security
+	// header sent with HTTPS responses.  The header is not sent if zero.
+	HSTSMaxAge uint
+}
+
+// Enabled returns true if a certificate or key file is configured.
+func (cfg TLSConfig) Enabled() bool {
+	return cfg.CertFile != "" || cfg.KeyFile != ""
+}
+
+// certLoader provides the certificate for TLS handshakes and reloads it when
+// the certificate or key file changes.
+type certLoader struct {
+	certFile string
+	keyFile  string
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	// failedCertMod and failedKeyMod are the modification times of the files
+	// that last failed to load, and failure is the error that was last
+	// logged, so that each change is tried and logged only once
+	failedCertMod time.Time
+	failedKeyMod  time.Time
+	failure       string
+}
+
+// newCertLoader loads the certificate and key from the given files.
+func newCertLoader(certFile, keyFile string, log *slog.Logger) (*certLoader, error) {
+	cl := &certLoader{certFile: certFile, keyFile: keyFile, log: log}
+	if err := cl.load(); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// load reads the certificate and key files and replaces the current
+// certificate.  The lock must be held (or the loader not yet shared).
+func (cl *certLoader) load() error {
+	certMod, keyMod, err := cl.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cl.certFile, cl.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %v", err)
+	}
+	cl.cert = &cert
+	cl.certMod = certMod
+	cl.keyMod = keyMod
+	return nil
+}
+
+// modTimes returns the modification times of the certificate and key files.
+func (cl *certLoader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cl.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("loading TLS certificate: %v", err)
+	}
+	keyInfo, err := os.Stat(cl.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("loading TLS key: %v", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if
+// either file changed since it was loaded.  If reloading fails, the previous
+// certificate is used and the error is logged.  Files that failed to load are
+// not tried again until they change.
+func (cl *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	certMod, keyMod, err := cl.modTimes()
+	if err != nil {
+		cl.reloadFailed(err)
+		return cl.cert, nil
+	}
+	if certMod.Equal(cl.certMod) && keyMod.Equal(cl.keyMod) {
+		return cl.cert, nil
+	}
+	if certMod.Equal(cl.failedCertMod) && keyMod.Equal(cl.failedKeyMod) {
+		return cl.cert, nil
+	}
+	if err := cl.load(); err != nil {
+		cl.failedCertMod, cl.failedKeyMod = certMod, keyMod
+		cl.reloadFailed(err)
+		return cl.cert, nil
+	}
+	cl.failure = ""
+	cl.log.Info("Reloaded TLS certificate", "cert", cl.certFile)
+	return cl.cert, nil
+}
+
+// reloadFailed logs the error of a failed reload unless it was the last one
+// logged.  The lock must be held.
+func (cl *certLoader) reloadFailed(err error) {
+	if err.Error() == cl.failure {
+		return
+	}
+	cl.failure = err.Error()
+	cl.log.Error("Failed to reload TLS certificate", "cert", cl.certFile, "error", err)
+}
+
+// SetTLS configures the server to serve HTTPS with the certificate and key
+// in the configuration, and to redirect plain HTTP requests and send the HSTS
+// header if configured.  It must be called before Start.  An error is
+// returned if the certificate can't be loaded.
+func (ws *Server) SetTLS(cfg TLSConfig) error {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return fmt.Errorf("TLS requires both a certificate and a key file")
+	}
+	loader, err := newCertLoader(cfg.CertFile, cfg.KeyFile, ws.log)
+	if err != nil {
+		return err
+	}
+	ws.certs = loader
+	ws.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: loader.GetCertificate,
+	}
+	ws.tls = cfg
+	if cfg.RedirectPort != 0 {
+		ws.redirect = &http.Server{
+			Addr:         fmt.Sprintf(":%d", cfg.RedirectPort),
+			Handler:      redirectHandler(ws.Addr),
+			ReadTimeout:  ws.ReadTimeout,
+			WriteTimeout: ws.WriteTimeout,
+			IdleTimeout:  ws.IdleTimeout,
+		}
+	}
+	return nil
+}
+
+// redirectHandler returns a handler that redirects requests to the same host
+// and path over HTTPS on the port of the given address.
+func redirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// hsts is a middleware that adds the Strict-Transport-Security header to
+// responses sent over TLS if an HSTS max-age is configured.
+func (ws *Server) hsts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && ws.tls.HSTSMaxAge > 0 {
+			w.Header().Set("Strict-Transport-Security", "max-age="+strconv.FormatUint(uint64(ws.tls.HSTSMaxAge), 10))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
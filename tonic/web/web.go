@@ -4,30 +4,25 @@ import (
 	"context"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
-	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/G-Node/tonic/templates"
+	"github.com/G-Node/tonic/tonic/i18n"
+	"github.com/G-Node/tonic/tonic/metrics"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ErrorResponse logs an error and renders an error page with the given message,
 // returning the given status code to the user.
-func (ws *Server) ErrorResponse(w http.ResponseWriter, status int, message string) {
-	w.WriteHeader(status)
-
-	tmpl := template.New("layout")
-	tmpl, err := tmpl.Parse(templates.Layout)
-	if err != nil {
-		tmpl = template.New("content")
-	}
-	tmpl, err = tmpl.Parse(templates.Fail)
-	if err != nil {
-		w.Write([]byte(message))
-		return
-	}
+// The message is translated to the language of the request.
+func (ws *Server) ErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
 	errinfo := struct {
 		StatusCode int
 		StatusText string
@@ -35,10 +30,12 @@ func (ws *Server) ErrorResponse(w http.ResponseWriter, status int, message strin
 	}{
 		status,
 		http.StatusText(status),
-		message,
+		ws.Locale(r).T(message),
 	}
-	if err := tmpl.Execute(w, &errinfo); err != nil {
-		ws.log.Printf("Error rendering fail page: %v", err)
+	if err := ws.Render(w, r, status, FailTemplate, &errinfo); err != nil {
+		ws.log.Error("Error rendering fail page", "error", err)
+		w.WriteHeader(status)
+		w.Write([]byte(message))
 	}
 }
 
@@ -46,7 +43,28 @@ func (ws *Server) ErrorResponse(w http.ResponseWriter, status int, message strin
 type Server struct {
 	*http.Server
 	Router *mux.Router
-	log    *log.Logger
+	log    *slog.Logger
+	// listener is closed on Stop in case Serve hasn't started using it yet.
+	listener net.Listener
+	// tls, certs, and redirect are set by SetTLS.
+	tls      TLSConfig
+	certs    *certLoader
+	redirect *http.Server
+	// basePath and trustedProxies are set by SetBasePath and
+	// SetTrustedProxies.
+	basePath       string
+	trustedProxies []*net.IPNet
+	// theme is set by SetTheme.
+	theme atomic.Pointer[Theme]
+	// templates holds the text of the page templates by name and pages the
+	// parsed pages combined with the Layout by language and name (nil until
+	// parsed).
+	templates map[string]string
+	pages     map[string]map[string]*template.Template
+	tmplLock  sync.Mutex
+	// bundle holds the message catalogues; the templates are parsed for each
+	// of its languages.
+	bundle *i18n.Bundle
 }
 
 // New returns a web Server with an initialised mux.Router and http.Server.
@@ -54,10 +72,16 @@ func New(port uint16) *Server {
 	srv := new(Server)
 	// Set default logger.
 	// Can be later replaced using the SetLogger() method.
-	srv.log = log.New(os.Stderr, "", log.LstdFlags)
+	srv.log = slog.Default()
+	srv.templates = defaultTemplates()
+	srv.bundle = i18n.NewBundle("")
 	srv.Router = new(mux.Router)
+	srv.Router.Use(instrument)
 	httpsrv := new(http.Server)
-	httpsrv.Handler = srv.Router
+	// Each request is traced; the span is named after the matched route by
+	// the instrument middleware.  Forwarded headers are applied and the base
+	// path is removed before the request reaches the router.
+	httpsrv.Handler = srv.forwarded(srv.hsts(srv.stripBasePath(srv.language(otelhttp.NewHandler(srv.Router, "HTTP request")))))
 
 	httpsrv.Addr = fmt.Sprintf(":%d", port)
 	// Good practice to set timeouts to avoid Slowloris attacks.
@@ -69,20 +93,62 @@ func New(port uint16) *Server {
 }
 
 // SetLogger sets the logger instance for the web service.  If unset the service
-// defines its own logger with the same configuration as the standard Logger.
-func (ws *Server) SetLogger(l *log.Logger) {
+// uses the default slog Logger.
+func (ws *Server) SetLogger(l *slog.Logger) {
 	ws.log = l
+	if ws.certs != nil {
+		ws.certs.mu.Lock()
+		ws.certs.log = l
+		ws.certs.mu.Unlock()
+	}
 }
 
-// Start starts the embedded web server's ListenAndServe method in a goroutine
-// and returns.  This method does not block. Use WaitForInterrupt() or
-// implement your own blocking function to wait for any other stop condition.
-func (ws *Server) Start() {
+// Start listens on the server address and starts serving requests in a
+// goroutine.  This method does not block, but the server accepts connections
+// as soon as it returns.  Use WaitForInterrupt() or implement your own
+// blocking function to wait for any other stop condition.  An error is
+// returned if the templates are invalid (see ParseTemplates) or the server
+// fails to listen on the address.  If TLS is configured, the server serves
+// HTTPS and the HTTP redirect listener, if any, is started as well.
+func (ws *Server) Start() error {
+	if err := ws.ParseTemplates(); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", ws.Addr)
+	if err != nil {
+		return err
+	}
+	var redirectListener net.Listener
+	if ws.redirect != nil {
+		redirectListener, err = net.Listen("tcp", ws.redirect.Addr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	ws.listener = listener
 	go func() {
-		if err := ws.ListenAndServe(); err != nil {
-			ws.log.Println(err)
+		var err error
+		if ws.TLSConfig != nil {
+			// certificates are provided by TLSConfig.GetCertificate
+			err = ws.ServeTLS(listener, "", "")
+		} else {
+			err = ws.Serve(listener)
+		}
+		if err == http.ErrServerClosed {
+			ws.log.Info("Web server closed")
+		} else if err != nil {
+			ws.log.Error("Web server stopped", "error", err)
 		}
 	}()
+	if redirectListener != nil {
+		go func() {
+			if err := ws.redirect.Serve(redirectListener); err != nil && err != http.ErrServerClosed {
+				ws.log.Error("HTTP redirect server stopped", "error", err)
+			}
+		}()
+	}
+	return nil
 }
 
 // Stop gracefully stops the web service.
@@ -90,5 +156,44 @@ func (ws *Server) Stop() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	// Gracefully shut down, waiting for the timeout deadline for connections to close.
+	if ws.redirect != nil {
+		ws.redirect.Shutdown(ctx)
+	}
 	ws.Shutdown(ctx)
+	if ws.listener != nil {
+		ws.listener.Close()
+	}
+}
+
+// statusRecorder is an http.ResponseWriter that records the status code of the
+// response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// instrument is a middleware that counts requests and observes their latency
+// for each route.  Requests are labelled with the route template (e.g.,
+// "/log/{id:[0-9]+}") to keep the number of label values bounded.  The
+// request span is named after the method and route template.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tmpl, err := cur.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		trace.SpanFromContext(r.Context()).SetName(r.Method + " " + route)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+	})
 }
@@ -1,18 +1,34 @@
 package web
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestWebPlain(t *testing.T) {
 	srv := New(4242)
 
-	srv.Start()
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start web server: %v", err)
+	}
 	defer srv.Stop()
 }
 
@@ -38,7 +54,9 @@ func TestWebWithRoutes(t *testing.T) {
 	router.HandleFunc("/test", testget).Methods("GET")
 	router.HandleFunc("/test", testpost).Methods("POST")
 
-	srv.Start()
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start web server: %v", err)
+	}
 	defer srv.Stop()
 
 	if resp, err := http.Get("http://localhost:4242/test"); err != nil {
@@ -66,10 +84,12 @@ func TestErrorResponse(t *testing.T) {
 
 	expresp := "TESTING:UNAUTHORISED"
 	testget := func(w http.ResponseWriter, r *http.Request) {
-		srv.ErrorResponse(w, http.StatusUnauthorized, expresp)
+		srv.ErrorResponse(w, r, http.StatusUnauthorized, expresp)
 	}
 	router.HandleFunc("/test", testget).Methods("GET")
-	srv.Start()
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start web server: %v", err)
+	}
 	defer srv.Stop()
 
 	if resp, err := http.Get("http://localhost:4242/test"); err != nil {
@@ -80,3 +100,297 @@ func TestErrorResponse(t *testing.T) {
 		t.Fatalf("Got unexpected response from get request: %s", string(b))
 	}
 }
+
+// writeCert writes a self-signed certificate for localhost with the given
+// common name and its key to the given files.
+func writeCert(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func TestWebTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+
+	srv := New(4242)
+	if err := srv.SetTLS(TLSConfig{CertFile: certFile}); err == nil {
+		t.Fatal("SetTLS without a key file succeeded")
+	}
+	if err := srv.SetTLS(TLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Fatal("SetTLS with a missing key file succeeded")
+	}
+	if err := srv.SetTLS(TLSConfig{CertFile: certFile, KeyFile: keyFile, RedirectPort: 4243, HSTSMaxAge: 3600}); err != nil {
+		t.Fatalf("Failed to set up TLS: %v", err)
+	}
+	srv.Router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start web server: %v", err)
+	}
+	defer srv.Stop()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	get := func(url string) *http.Response {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("Error testing get request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("https://localhost:4242/test")
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != "max-age=3600" {
+		t.Fatalf("Unexpected HSTS header: %q", hsts)
+	}
+	if name := resp.TLS.PeerCertificates[0].Subject.CommonName; name != "first" {
+		t.Fatalf("Unexpected certificate: %q", name)
+	}
+
+	resp = get("http://localhost:4243/test?q=1")
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Fatalf("Unexpected redirect status: %d", resp.StatusCode)
+	}
+	if loc := resp.Header.Get("Location"); loc != "https://localhost:4242/test?q=1" {
+		t.Fatalf("Unexpected redirect location: %q", loc)
+	}
+
+	// replaced certificates are used for new connections
+	writeCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	resp = get("https://localhost:4242/test")
+	if name := resp.TLS.PeerCertificates[0].Subject.CommonName; name != "second" {
+		t.Fatalf("Certificate was not reloaded: %q", name)
+	}
+}
+
+func TestCertReloadFailure(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+
+	logs := new(strings.Builder)
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	loader, err := newCertLoader(certFile, keyFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	handshake := func() string {
+		cert, _ := loader.GetCertificate(nil)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %v", err)
+		}
+		return parsed.Subject.CommonName
+	}
+	touch := func(offset time.Duration) {
+		mod := time.Now().Add(offset)
+		os.Chtimes(certFile, mod, mod)
+		os.Chtimes(keyFile, mod, mod)
+	}
+
+	// a half-written certificate is tried and logged once
+	if err := os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----\n"), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	touch(time.Minute)
+	for n := 0; n < 3; n++ {
+		if name := handshake(); name != "first" {
+			t.Fatalf("Previous certificate not used after failed reload: %q", name)
+		}
+	}
+	if n := strings.Count(logs.String(), "Failed to reload TLS certificate"); n != 1 {
+		t.Fatalf("Failed reload logged %d times:\n%s", n, logs)
+	}
+
+	// a missing file is logged once
+	os.Remove(keyFile)
+	for n := 0; n < 3; n++ {
+		handshake()
+	}
+	if n := strings.Count(logs.String(), "Failed to reload TLS certificate"); n != 2 {
+		t.Fatalf("Missing key logged %d times:\n%s", n-1, logs)
+	}
+
+	// the completed certificate is loaded
+	writeCert(t, certFile, keyFile, "second")
+	touch(2 * time.Minute)
+	if name := handshake(); name != "second" {
+		t.Fatalf("Certificate was not reloaded: %q", name)
+	}
+}
+
+func TestForwarded(t *testing.T) {
+	srv := New(4242)
+	if err := srv.SetTrustedProxies([]string{"not an address"}); err == nil {
+		t.Fatal("SetTrustedProxies with an invalid address succeeded")
+	}
+	if err := srv.SetTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+	srv.Router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("%s %s %t", r.RemoteAddr, r.Host, IsSecure(r))))
+	})
+
+	get := func(remote, xff string) string {
+		req := httptest.NewRequest("GET", "http://service.local/test", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", xff)
+		req.Header.Set("X-Forwarded-Host", "gin.example.org")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rr := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rr, req)
+		return rr.Body.String()
+	}
+
+	if resp := get("127.0.0.1:4321", "192.0.2.1, 10.1.2.3"); resp != "192.0.2.1 gin.example.org true" {
+		t.Fatalf("Unexpected response from trusted proxy: %q", resp)
+	}
+	if resp := get("192.0.2.7:4321", "192.0.2.1"); resp != "192.0.2.7:4321 service.local false" {
+		t.Fatalf("Unexpected response from untrusted client: %q", resp)
+	}
+}
+
+func TestAssetHandler(t *testing.T) {
+	embedded := fstest.MapFS{
+		"style.css":     {Data: []byte("body {}")},
+		"logo.png":      {Data: []byte("embedded logo")},
+		"fonts/a.woff2": {Data: []byte("font")},
+	}
+	override := t.TempDir()
+	if err := os.WriteFile(filepath.Join(override, "logo.png"), []byte("custom logo"), 0600); err != nil {
+		t.Fatalf("Failed to write override file: %v", err)
+	}
+	handler := http.StripPrefix("/assets/", AssetHandler(embedded, override))
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/assets/style.css", "")
+	if rr.Code != http.StatusOK || rr.Body.String() != "body {}" {
+		t.Fatalf("Unexpected embedded asset response: %d %q", rr.Code, rr.Body.String())
+	}
+	if cc := rr.Header().Get("Cache-Control"); cc != AssetCacheControl {
+		t.Fatalf("Unexpected Cache-Control header: %q", cc)
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Embedded asset has no ETag")
+	}
+	if rr := get("/assets/style.css", etag); rr.Code != http.StatusNotModified {
+		t.Fatalf("Conditional request returned %d (expected %d)", rr.Code, http.StatusNotModified)
+	}
+
+	rr = get("/assets/logo.png", "")
+	if rr.Body.String() != "custom logo" {
+		t.Fatalf("Override file not served: %q", rr.Body.String())
+	}
+	if rr := get("/assets/logo.png", rr.Header().Get("ETag")); rr.Code != http.StatusNotModified {
+		t.Fatalf("Conditional request for override file returned %d", rr.Code)
+	}
+
+	if rr := get("/assets/fonts/a.woff2", ""); rr.Body.String() != "font" {
+		t.Fatalf("Nested embedded asset not served: %q", rr.Body.String())
+	}
+	for _, path := range []string{"/assets/missing.css", "/assets/fonts", "/assets/", "/assets/../web.go"} {
+		if rr := get(path, ""); rr.Code != http.StatusNotFound {
+			t.Fatalf("%s returned %d (expected %d)", path, rr.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	srv := New(4242)
+	if err := srv.AddPage(FormTemplate, `{{ define "content" }}{{ end }}`); err == nil {
+		t.Fatal("Adding a page with the name of a built-in template succeeded")
+	}
+	if err := srv.AddPage("about", `{{ define "content" }}<p>About {{.}}</p>{{ end }}`); err != nil {
+		t.Fatalf("Failed to add page: %v", err)
+	}
+	if err := srv.AddPage("about", `{{ define "content" }}{{ end }}`); err == nil {
+		t.Fatal("Adding a page twice succeeded")
+	}
+	if err := srv.ParseTemplates(); err != nil {
+		t.Fatalf("Failed to parse templates: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	if err := srv.Render(rr, httptest.NewRequest("GET", "/", nil), http.StatusAccepted, "about", "Tonic"); err != nil {
+		t.Fatalf("Failed to render page: %v", err)
+	}
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "<p>About Tonic</p>") || !strings.Contains(rr.Body.String(), "</html>") {
+		t.Fatalf("Unexpected rendered page: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	if err := srv.Render(rr, httptest.NewRequest("GET", "/", nil), http.StatusOK, "missing", nil); err == nil {
+		t.Fatal("Rendering an unknown page succeeded")
+	}
+	if rr.Body.Len() != 0 {
+		t.Fatal("Failed rendering wrote a response")
+	}
+
+	// templates that parse on their own but don't fit the layout fail Start
+	if err := srv.AddPage("broken", `<p>No content</p>`); err != nil {
+		t.Fatalf("Failed to add page: %v", err)
+	}
+	if err := srv.ParseTemplates(); err == nil {
+		t.Fatal("Parsing a page without content succeeded")
+	}
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Fatal("Starting with an invalid page succeeded")
+	}
+
+	srv = New(4242)
+	if err := srv.SetTemplate(LayoutTemplate, `<html>{{ template "content" . }}</html>`); err != nil {
+		t.Fatalf("Failed to set template: %v", err)
+	}
+	if err := srv.ParseTemplates(); err == nil {
+		t.Fatal("Parsing a Layout without \"layout\" succeeded")
+	}
+}
@@ -0,0 +1,88 @@
+package tonic
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/G-Node/tonic/tonic/worker"
+)
+
+// maxWebhookPayload is the maximum size of an accepted webhook payload.
+const maxWebhookPayload = 10 << 20
+
+// HandleEvent registers an action that runs as a job for every webhook event
+// of the given type (e.g., "push", "create", "repository") received from the
+// GIN server.  Registering an action for an event type replaces any previous
+// action for the same type.
+func (srv *Tonic) HandleEvent(eventType string, action worker.EventAction) {
+	srv.eventLock.Lock()
+	defer srv.eventLock.Unlock()
+	srv.eventActions[eventType] = action
+}
+
+// receiveWebhook verifies a webhook delivery from the GIN server and
+// enqueues a job for the event if an action is registered for its type.
+func (srv *Tonic) receiveWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := srv.config.Load().Webhook.Secret.Reveal()
+	if secret == "" {
+		// never accept unsigned events
+		http.Error(w, "webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return
+	}
+	if !verifySignature(secret, payload, r.Header.Get("X-Gogs-Signature")) {
+		srv.log.Warn("Rejected webhook delivery with invalid signature", "remote", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	eventType := r.Header.Get("X-Gogs-Event")
+	srv.eventLock.RLock()
+	action, ok := srv.eventActions[eventType]
+	srv.eventLock.RUnlock()
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "ignoring %q event", eventType)
+		return
+	}
+
+	event, err := worker.ParseEvent(eventType, r.Header.Get("X-Gogs-Delivery"), payload)
+	if err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	label := fmt.Sprintf("Event: %s %s", event.Type, event.Repository)
+	j := srv.worker.NewEventJob(label, *event, action)
+	if err := srv.worker.EnqueueContext(r.Context(), j); err != nil {
+		srv.log.Error("Failed to enqueue event", "event", eventType, "error", err)
+		w.Header().Set("Retry-After", strconv.Itoa(busyRetryAfter))
+		http.Error(w, "service busy", http.StatusServiceUnavailable)
+		return
+	}
+	srv.log.Info("Received event", "event", event.Type, "delivery", event.Delivery, "repository", event.Repository, "job", j.ID)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "queued as job %d", j.ID)
+}
+
+// verifySignature checks that the signature is the hex encoded HMAC-SHA256 of
+// the payload computed with the given secret.
+func verifySignature(secret string, payload []byte, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
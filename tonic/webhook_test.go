@@ -0,0 +1,111 @@
+package tonic
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/G-Node/tonic/tonic/form"
+	"github.com/G-Node/tonic/tonic/worker"
+)
+
+func TestWebhook(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	config := Config{}
+	config.Webhook.Secret = "webhook-secret"
+	srv, err := NewService(*f, nil, echoAction, config)
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+
+	received := make(chan worker.Event, 1)
+	srv.HandleEvent("push", func(event worker.Event, _ *worker.Client) ([]string, error) {
+		received <- event
+		return []string{"relinked " + event.Repository}, nil
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("failed to start tonic service: %s", err.Error())
+	}
+	defer srv.Stop()
+
+	payload := []byte(`{"ref": "refs/heads/master", "repository": {"full_name": "lab/project.main"}, "sender": {"login": "alice"}}`)
+	sign := func(secret string, payload []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	deliver := func(event, signature string, payload []byte, expectedStatus int) {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/webhook", bytes.NewReader(payload))
+		if err != nil {
+			t.Fatal("failed to create request: POST /webhook")
+		}
+		req.Header.Add("X-Gogs-Event", event)
+		req.Header.Add("X-Gogs-Delivery", "delivery-1")
+		if signature != "" {
+			req.Header.Add("X-Gogs-Signature", signature)
+		}
+		srv.web.Handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("webhook returned wrong status code for %q event: got %v expected %v", event, status, expectedStatus)
+		}
+	}
+
+	deliver("push", "", payload, http.StatusUnauthorized)
+	deliver("push", sign("wrong-secret", payload), payload, http.StatusUnauthorized)
+	deliver("push", "not-hex", payload, http.StatusUnauthorized)
+	deliver("fork", sign("webhook-secret", payload), payload, http.StatusOK)
+	deliver("push", sign("webhook-secret", payload), payload, http.StatusAccepted)
+
+	select {
+	case event := <-received:
+		if event.Type != "push" || event.Repository != "lab/project.main" || event.Sender != "alice" || event.Delivery != "delivery-1" {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+		if !bytes.Equal(event.Payload, payload) {
+			t.Fatalf("unexpected event payload: %s", string(event.Payload))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event action did not run")
+	}
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		jobs, err := srv.db.GetEventJobs(10)
+		if err != nil {
+			t.Fatalf("failed to retrieve event jobs: %s", err.Error())
+		}
+		if len(jobs) == 1 && !jobs[0].EndTime.IsZero() {
+			if jobs[0].Event != "push" || jobs[0].Messages[0] != "relinked lab/project.main" {
+				t.Fatalf("unexpected event job: %s %v", jobs[0].Event, jobs[0].Messages)
+			}
+			return
+		}
+	}
+	t.Fatal("event job not recorded")
+}
+
+func TestWebhookDisabled(t *testing.T) {
+	f := new(form.Form)
+	f.Pages = []form.Page{{Elements: make([]form.Element, 1)}}
+	srv, err := NewService(*f, nil, echoAction, Config{})
+	if err != nil {
+		t.Fatalf("failed to initialise tonic service: %s", err.Error())
+	}
+	srv.HandleEvent("push", func(event worker.Event, _ *worker.Client) ([]string, error) {
+		return nil, nil
+	})
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhook", bytes.NewReader([]byte("{}")))
+	req.Header.Add("X-Gogs-Event", "push")
+	srv.web.Handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("webhook without secret returned wrong status code: got %v expected %v", status, http.StatusNotFound)
+	}
+}
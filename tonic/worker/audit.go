@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/G-Node/tonic/tonic/db"
+)
+
+// Actors of audited API calls.
+const (
+	AuditBot  = "bot"
+	AuditUser = "user"
+)
+
+// audit identifies the user and job that cause the API calls of a client for
+// the audit log.
+type audit struct {
+	db     *db.Connection
+	actor  string
+	userID int64
+	jobID  int64
+}
+
+// Audit returns a copy of the client that records every change it makes
+// through the GIN API (any request except GET, HEAD, and OPTIONS) in the
+// audit log of the database (see db.AuditEntry).  The changes are attributed
+// to the given user and job (0 outside of jobs), and the actor names the
+// account the client acts as (AuditBot or AuditUser).  The copy shares the
+// GIN client and context of the original.
+func (client *Client) Audit(conn *db.Connection, actor string, userID, jobID int64) *Client {
+	if client == nil {
+		return nil
+	}
+	a := &audit{db: conn, actor: actor, userID: userID, jobID: jobID}
+	c := newClient(client.ctx, a, client.webURL, client.gitURL, client.token)
+	c.GIN = client.GIN
+	return c
+}
+
+// auditTransport records the requests that change data in the audit log.
+type auditTransport struct {
+	audit *audit
+	next  http.RoundTripper
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.next.RoundTrip(req)
+	}
+
+	entry := &db.AuditEntry{
+		Time:     time.Now(),
+		UserID:   t.audit.userID,
+		JobID:    t.audit.jobID,
+		Actor:    t.audit.actor,
+		Method:   req.Method,
+		Endpoint: req.URL.Path,
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Status = resp.StatusCode
+		if resp.StatusCode/100 != 2 {
+			entry.Error = responseError(resp)
+		}
+	}
+	t.audit.insert(entry)
+	return resp, err
+}
+
+// record adds an API call that was not made through the client's transport
+// (e.g., by the gin-cli client) to the audit log.  A successful call is
+// recorded with the given status.
+func (a *audit) record(method, endpoint string, status int, err error) {
+	if a == nil {
+		return
+	}
+	entry := &db.AuditEntry{
+		Time:     time.Now(),
+		UserID:   a.userID,
+		JobID:    a.jobID,
+		Actor:    a.actor,
+		Method:   method,
+		Endpoint: endpoint,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Status = status
+	}
+	a.insert(entry)
+}
+
+func (a *audit) insert(entry *db.AuditEntry) {
+	if dberr := a.db.InsertAuditEntry(entry); dberr != nil {
+		slog.Error("Failed to record API call in audit log", "method", entry.Method, "endpoint", entry.Endpoint, "job", entry.JobID, "error", dberr)
+	}
+}
+
+// maxErrorBody is the maximum size of an error response that is read for the
+// audit log.
+const maxErrorBody = 64 << 10
+
+// responseError returns the error message of a failed API response, or its
+// status if it has none.  The body of the response is restored so that the
+// API client can read it.
+func responseError(resp *http.Response) string {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil {
+		return resp.Status
+	}
+	var apiError struct {
+		Message string
+	}
+	if json.Unmarshal(body, &apiError) == nil && apiError.Message != "" {
+		return apiError.Message
+	}
+	return resp.Status
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"encoding/json"
+)
+
+// Event holds the information of a webhook event received from the GIN
+// server.
+type Event struct {
+	// Type of the event as sent by the server (e.g., "push", "create",
+	// "repository").
+	Type string
+	// Unique ID of the delivery as sent by the server.
+	Delivery string
+	// Full name (owner/name) of the repository the event refers to (empty
+	// for events that don't refer to a repository).
+	Repository string
+	// Name of the organisation the event refers to (if any).
+	Organisation string
+	// Login name of the user who triggered the event.
+	Sender string
+	// Payload is the raw JSON payload of the event.  It can be decoded with
+	// the functions of the gogs client (e.g., gogs.ParsePushHook()).
+	Payload []byte
+}
+
+// EventAction is a function that handles a webhook event.  It runs as a job
+// with the bot client and should return a list of messages and/or an error,
+// like a PostAction.
+type EventAction func(event Event, botClient *Client) ([]string, error)
+
+// ParseEvent reads the common fields of a webhook payload into a new Event of
+// the given type.
+func ParseEvent(eventType, delivery string, payload []byte) (*Event, error) {
+	fields := struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Organization struct {
+			UserName string `json:"username"`
+		} `json:"organization"`
+		Sender struct {
+			Login    string `json:"login"`
+			UserName string `json:"username"`
+		} `json:"sender"`
+	}{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	sender := fields.Sender.Login
+	if sender == "" {
+		sender = fields.Sender.UserName
+	}
+	return &Event{
+		Type:         eventType,
+		Delivery:     delivery,
+		Repository:   fields.Repository.FullName,
+		Organisation: fields.Organization.UserName,
+		Sender:       sender,
+		Payload:      payload,
+	}, nil
+}
+
+// NewEventJob returns a new UserJob that runs the given EventAction for the
+// event as the bot user of the worker.
+func (w *Worker) NewEventJob(label string, event Event, action EventAction) *UserJob {
+	values := map[string][]string{
+		"event":        {event.Type},
+		"delivery":     {event.Delivery},
+		"repository":   {event.Repository},
+		"organisation": {event.Organisation},
+		"sender":       {event.Sender},
+	}
+	j := w.NewBotJob(label, values, func(_ map[string][]string, botClient, _ *Client) ([]string, error) {
+		return action(event, botClient)
+	})
+	j.Event = event.Type
+	return j
+}
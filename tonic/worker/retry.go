@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryableError wraps an error returned by a PostAction to signal that the
+// failure is transient (e.g., a network error) and that the job can be run
+// again.
+type RetryableError struct {
+	Err error
+}
+
+// Error returns the message of the wrapped error.
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable wraps the given error in a RetryableError.  A nil error is
+// returned unchanged.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// IsRetryable returns true if the error, or any error it wraps, is a
+// RetryableError.
+func IsRetryable(err error) bool {
+	var rerr *RetryableError
+	return errors.As(err, &rerr)
+}
+
+// defaultMaxRetryDelay bounds the delay between attempts when the policy
+// doesn't set MaxDelay.
+const defaultMaxRetryDelay = 24 * time.Hour
+
+// RetryPolicy defines how jobs that fail with a RetryableError are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a job is run.  Values less
+	// than 2 disable retries.
+	MaxAttempts int
+	// Delay before the first retry.  The delay is doubled after every
+	// attempt.
+	Delay time.Duration
+	// MaxDelay is the upper bound for the delay between attempts.  Zero means
+	// a bound of one day.
+	MaxDelay time.Duration
+}
+
+// Backoff returns the delay before the next run of a job that has been run
+// 'attempts' times.
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRetryDelay
+	}
+	delay := p.Delay
+	// stop doubling at the bound so that the delay can't overflow
+	for n := 1; n < attempts && delay < maxDelay; n++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
@@ -1,9 +1,14 @@
 package worker
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/G-Node/gin-cli/ginclient"
@@ -12,7 +17,13 @@ import (
 	"github.com/G-Node/gin-cli/web"
 	"github.com/G-Node/tonic/tonic/db"
 	"github.com/G-Node/tonic/tonic/form"
+	"github.com/G-Node/tonic/tonic/metrics"
+	"github.com/G-Node/tonic/tonic/tracing"
 	"github.com/gogs/go-gogs-client"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PreAction is a function that receives the Form struct as defined for the
@@ -27,6 +38,13 @@ type PreAction func(f form.Form, botClient, userClient *Client) (*form.Form, err
 // the form values and return a list of messages and/or an error if it fails.
 type PostAction func(v map[string][]string, botClient, userClient *Client) ([]string, error)
 
+// Notifier is notified when a job finishes (successfully or not).
+type Notifier interface {
+	// Notify is called with the finished job and the bot and user clients
+	// that ran it.
+	Notify(job *db.Job, botClient, userClient *Client) error
+}
+
 // Client embeds gogs.Client to extend functionality with new convenience
 // methods.  (New clients may be added in the future using the same interface).
 type Client struct {
@@ -38,18 +56,81 @@ type Client struct {
 	webURL string
 	gitURL string
 	token  string
+	// ctx is the context of the job the client is used for.  API calls and
+	// git operations are traced as its children.
+	ctx context.Context
+	// audit is set if the changes made by the client are recorded in the
+	// audit log (see Audit)
+	audit *audit
 }
 
-// NewClient returns a new worker Client.
+// NewClient returns a new worker Client.  The latency of the API calls made
+// through the client is recorded in the service metrics.
 func NewClient(webURL, gitURL, token string) *Client {
+	return newClient(context.Background(), nil, webURL, gitURL, token)
+}
+
+func newClient(ctx context.Context, a *audit, webURL, gitURL, token string) *Client {
 	gogsClient := gogs.NewClient(webURL, token)
-	return &Client{Client: gogsClient, webURL: webURL, gitURL: gitURL, token: token}
+	var transport http.RoundTripper = otelhttp.NewTransport(
+		metrics.InstrumentTransport(nil),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "GIN API " + r.Method + " " + r.URL.Path
+		}),
+	)
+	if a != nil {
+		transport = &auditTransport{audit: a, next: transport}
+	}
+	gogsClient.SetHTTPClient(&http.Client{Transport: &contextTransport{ctx: ctx, next: transport}})
+	return &Client{Client: gogsClient, webURL: webURL, gitURL: gitURL, token: token, ctx: ctx, audit: a}
+}
+
+// withContext returns a copy of the client that traces API calls and git
+// operations as children of the span in the given context.  The copy shares
+// the GIN client and audit of the original.
+func (client *Client) withContext(ctx context.Context) *Client {
+	if client == nil {
+		return nil
+	}
+	c := newClient(ctx, client.audit, client.webURL, client.gitURL, client.token)
+	c.GIN = client.GIN
+	return c
+}
+
+// contextTransport sets the context of each request before passing it on.
+// The gogs client creates requests without a context.
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+// startSpan starts a span for a git or git-annex operation as a child of the
+// client's context.
+func (client *Client) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracing.Tracer().Start(client.ctx, name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endSpan records the error (if any) and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 }
 
 // InitGINClient logs in to the GIN server, sets up the local configuration, and
 // returns a new ginclient.Client instance for running git and git-annex
 // commands.
-func (client *Client) InitGINClient() error {
+func (client *Client) InitGINClient() (err error) {
+	span := client.startSpan("gin login", attribute.String("tonic.gin.git", client.gitURL))
+	defer func() { endSpan(span, err) }()
+
 	webcfg, err := ginconfig.ParseWebString(client.webURL)
 	if err != nil {
 		return err
@@ -78,7 +159,11 @@ func (client *Client) InitGINClient() error {
 		return err
 	}
 	client.GIN.UserToken = web.UserToken{Username: userinfo.Login, Token: client.token}
-	return client.GIN.MakeSessionKey()
+	// the gin-cli client uploads the key with its own HTTP client, so the
+	// change is recorded here
+	err = client.GIN.MakeSessionKey()
+	client.audit.record(http.MethodPost, "/api/v1/user/keys", http.StatusCreated, err)
+	return err
 }
 
 // CloneRepo clones repository 'repo' into directory 'destdir'. The repository
@@ -98,23 +183,29 @@ func (client *Client) CloneRepo(repo, destdir string) error {
 		return err
 	}
 
+	span := client.startSpan("git clone", attribute.String("tonic.repository", repo))
 	clonechan := make(chan git.RepoFileStatus)
 	go client.GIN.CloneRepo(strings.ToLower(repo), clonechan)
 	for stat := range clonechan {
-		log.Print(stat)
+		slog.Debug("Clone", "repository", repo, "status", stat)
 		if stat.Err != nil {
+			endSpan(span, stat.Err)
 			return stat.Err
 		}
 	}
+	endSpan(span, nil)
 
+	span = client.startSpan("git-annex get", attribute.String("tonic.repository", repo))
 	downloadchan := make(chan git.RepoFileStatus)
 	go client.GIN.GetContent(nil, downloadchan)
 	for stat := range downloadchan {
-		log.Print(stat)
+		slog.Debug("Download content", "repository", repo, "status", stat)
 		if stat.Err != nil {
+			endSpan(span, stat.Err)
 			return stat.Err
 		}
 	}
+	endSpan(span, nil)
 	return nil
 }
 
@@ -123,6 +214,8 @@ func (client *Client) CloneRepo(repo, destdir string) error {
 type UserJob struct {
 	*db.Job
 	client *Client
+	// action overrides the PostAction of the worker for this job.
+	action PostAction
 }
 
 // NewUserJob returns a new UserJob initialised with the given custom function
@@ -139,14 +232,49 @@ func NewUserJob(client *Client, label string, values map[string][]string) *UserJ
 	for k, v := range values {
 		j.ValueMap[k] = v
 	}
+	j.Fingerprint = db.Fingerprint(j.ValueMap)
+	return j
+}
+
+// SetAction sets the action that runs the job in place of the PostAction of
+// the worker (e.g., the action of the form the job was submitted from).
+func (j *UserJob) SetAction(action PostAction) {
+	j.action = action
+}
+
+// DefaultQueueLength is the capacity of the worker queue if none is specified.
+const DefaultQueueLength = 100
+
+var (
+	// ErrQueueFull is returned by Enqueue when the worker queue has reached
+	// its capacity.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrUserLimit is returned by Enqueue when the user that submitted the
+	// job has reached the limit of unfinished jobs.
+	ErrUserLimit = errors.New("too many unfinished jobs for user")
+)
+
+// NewBotJob returns a new UserJob that runs as the bot user of the worker.  The
+// job runs the given action, or the PostAction of the worker if action is nil.
+func (w *Worker) NewBotJob(label string, values map[string][]string, action PostAction) *UserJob {
+	client := w.client
+	if client == nil {
+		// no bot login (no server configured)
+		client = NewClient("", "", "")
+	}
+	j := NewUserJob(client, label, values)
+	j.action = action
 	return j
 }
 
 // Worker pool with queue for running Jobs asynchronously.
 type Worker struct {
 	queue chan *UserJob
-	// Sending any value through 'stop' will stop the worker.
+	// Closing 'stop' will stop the worker and cancel any pending retries.
 	stop chan bool
+	// retry defines if and when jobs that fail with a RetryableError are run
+	// again.
+	retry RetryPolicy
 	// PreAction is used to prepare data to show the user, such as populating
 	// form lists or showing information on static pages.
 	PreAction PreAction
@@ -156,96 +284,295 @@ type Worker struct {
 	// client is used to perform administrative actions as the bot user that
 	// represents the service.
 	client *Client
-	log    *log.Logger
+	log    *slog.Logger
+	// maxUserJobs is the maximum number of unfinished jobs per user (0: no
+	// limit).
+	maxUserJobs int
+	// userJobs counts the unfinished jobs of each user.
+	userJobs map[int64]int
+	// queueLock protects userJobs and serialises Enqueue calls.
+	queueLock sync.Mutex
+	// notifiers are notified when a job finishes.
+	notifiers  []Notifier
+	notifyLock sync.RWMutex
+	// running is true while the worker loop is reading jobs from the queue.
+	running atomic.Bool
+	// stopOnce makes Stop safe to call more than once.
+	stopOnce sync.Once
 }
 
-// New returns a new Worker attached to the given database.
-func New(dbconn *db.Connection) *Worker {
+// New returns a new Worker attached to the given database with a queue that
+// holds up to queueLength jobs.  If queueLength is not positive, the
+// DefaultQueueLength is used.
+func New(dbconn *db.Connection, queueLength int) *Worker {
 	w := new(Worker)
 	// Set default logger.
 	// Can be later replaced using the SetLogger() method.
-	w.log = log.New(os.Stderr, "", log.LstdFlags)
+	w.log = slog.Default()
 
-	// TODO: Define worker queue length in configuration
-	w.queue = make(chan *UserJob, 100)
+	if queueLength <= 0 {
+		queueLength = DefaultQueueLength
+	}
+	w.queue = make(chan *UserJob, queueLength)
 	w.stop = make(chan bool)
+	w.userJobs = make(map[int64]int)
 	w.db = dbconn
 	return w
 }
 
 // SetLogger sets the logger instance for the worker service.  If unset the
-// service defines its own logger with the same configuration as the standard
-// Logger.
-func (w *Worker) SetLogger(l *log.Logger) {
+// worker uses the default slog Logger.
+func (w *Worker) SetLogger(l *slog.Logger) {
 	w.log = l
 }
 
+// SetRetryPolicy sets the policy for retrying jobs that fail with a
+// RetryableError.  By default jobs are not retried.
+func (w *Worker) SetRetryPolicy(p RetryPolicy) {
+	w.retry = p
+}
+
+// SetMaxUserJobs sets the maximum number of unfinished jobs a single user can
+// have.  Jobs beyond the limit are rejected by Enqueue.  Zero disables the
+// limit (default).
+func (w *Worker) SetMaxUserJobs(n int) {
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+	w.maxUserJobs = n
+}
+
+// AddNotifier adds a Notifier that is notified whenever a job finishes.
+func (w *Worker) AddNotifier(n Notifier) {
+	w.notifyLock.Lock()
+	defer w.notifyLock.Unlock()
+	w.notifiers = append(w.notifiers, n)
+}
+
+// SetNotifiers replaces all the notifiers of the worker.
+func (w *Worker) SetNotifiers(ns []Notifier) {
+	w.notifyLock.Lock()
+	defer w.notifyLock.Unlock()
+	w.notifiers = append([]Notifier(nil), ns...)
+}
+
+// getNotifiers returns the current notifiers.
+func (w *Worker) getNotifiers() []Notifier {
+	w.notifyLock.RLock()
+	defer w.notifyLock.RUnlock()
+	return w.notifiers
+}
+
 // SetClient assigns a service (bot) Client to the worker.
 func (w *Worker) SetClient(c *Client) {
 	w.client = c
 }
 
-// Enqueue adds the job to the queue and stores it in the database.
-func (w *Worker) Enqueue(j *UserJob) {
+// Client returns the service (bot) Client of the worker or nil if none is
+// set.
+func (w *Worker) Client() *Client {
+	return w.client
+}
+
+// Running returns true if the worker has been started and not stopped.
+func (w *Worker) Running() bool {
+	return w.running.Load()
+}
+
+// Enqueue adds the job to the queue and stores it in the database.  Enqueue
+// does not block: if the queue is full, or the user has reached the limit of
+// unfinished jobs, the job is not stored and ErrQueueFull or ErrUserLimit is
+// returned.
+func (w *Worker) Enqueue(j *UserJob) error {
+	return w.EnqueueContext(context.Background(), j)
+}
+
+// EnqueueContext is like Enqueue but traces the enqueuing as a child of the
+// span in the given context (e.g., the HTTP request that submitted the job).
+// The trace and span IDs are stored with the job so that its runs are part of
+// the same trace.
+func (w *Worker) EnqueueContext(ctx context.Context, j *UserJob) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "enqueue")
+	defer func() { endSpan(span, err) }()
+
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+
 	j.Lock()
-	w.log.Printf("J: %+v", j)
+	w.log.Debug("Enqueuing job", "label", j.Label, "user", j.UserID)
+	uid := j.UserID
 	j.SubmitTime = time.Now()
+	j.TraceID, j.SpanID = tracing.IDs(ctx)
+	span.SetAttributes(attribute.String("tonic.job.label", j.Label), attribute.Int64("tonic.user.id", uid))
 	j.Unlock()
-	err := w.db.InsertJob(j.Job)
-	if err != nil {
-		w.log.Printf("Error inserting job %+v into db: %v", j, err)
+
+	// Retries are added to the queue without going through Enqueue, so a
+	// free slot now doesn't guarantee one after inserting the job.  The
+	// non-blocking send below handles that (rare) case.
+	if len(w.queue) >= cap(w.queue) {
+		w.log.Warn("Queue full: rejecting job", "user", uid)
+		metrics.JobsRejected.WithLabelValues("queue_full").Inc()
+		return ErrQueueFull
+	}
+	if w.maxUserJobs > 0 && w.userJobs[uid] >= w.maxUserJobs {
+		w.log.Warn("User has too many unfinished jobs: rejecting job", "user", uid, "unfinished", w.userJobs[uid])
+		metrics.JobsRejected.WithLabelValues("user_limit").Inc()
+		return ErrUserLimit
+	}
+
+	if err := w.db.InsertJob(j.Job); err != nil {
+		w.log.Error("Error inserting job into db", "label", j.Label, "user", uid, "error", err)
+	}
+	span.SetAttributes(attribute.Int64("tonic.job.id", j.ID))
+	select {
+	case w.queue <- j:
+		w.userJobs[uid]++
+		metrics.QueueDepth.Set(float64(len(w.queue)))
+		return nil
+	default:
+		j.Lock()
+		j.Error = ErrQueueFull.Error()
+		j.EndTime = time.Now()
+		j.Unlock()
+		w.db.UpdateJob(j.Job)
+		metrics.JobsRejected.WithLabelValues("queue_full").Inc()
+		return ErrQueueFull
 	}
-	w.queue <- j
 }
 
-// PreprocessForm runs the defined PreAction and returns a modified Form.
-func (w *Worker) PreprocessForm(f *form.Form, userClient *Client) (*form.Form, error) {
-	if f == nil || w.PreAction == nil {
-		// nothing to do
-		return f, nil
+// finished updates the unfinished job count of the user of the given job.
+func (w *Worker) finished(uid int64) {
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+	if w.userJobs[uid] <= 1 {
+		delete(w.userJobs, uid)
+		return
 	}
-	botClient := w.client
-	return w.PreAction(*f, botClient, userClient)
+	w.userJobs[uid]--
 }
 
-// Stop sends the stop signal to the worker pool and closes the Job channel.
+// Stop sends the stop signal to the worker pool and cancels pending retries.
+// Calling Stop more than once has no effect.
 func (w *Worker) Stop() {
 	// TODO: Finish ongoing jobs?
-	w.stop <- true
+	w.stopOnce.Do(func() { close(w.stop) })
 }
 
 // run starts the custom function of the given job. When the job is
 // finished, it updates it with the returned messages and error (if any) and
-// updates the corresponding database entry.
+// updates the corresponding database entry.  Each run is recorded as a
+// db.Attempt.  If the custom function fails with a RetryableError and the
+// retry policy allows it, the job is queued again after the backoff delay
+// instead of finishing.
 func (w *Worker) run(j *UserJob) {
 	j.Lock()
 	defer j.Unlock()
 	defer w.db.UpdateJob(j.Job) // Update job entry in db when done
+	joblog := w.log.With("job", j.ID, "user", j.UserID, "label", j.Label)
+	joblog.Info("Running job", "attempt", j.Attempts+1)
 	var msgs []string
 	var err error
-	if w.PostAction != nil {
-		msgs, err = w.PostAction(j.ValueMap, w.client, j.client)
+	ctx := tracing.ContextWithIDs(context.Background(), j.TraceID, j.SpanID)
+	ctx, span := tracing.Tracer().Start(ctx, "job", trace.WithAttributes(
+		attribute.Int64("tonic.job.id", j.ID),
+		attribute.String("tonic.job.label", j.Label),
+		attribute.Int64("tonic.user.id", j.UserID),
+		attribute.Int("tonic.job.attempt", j.Attempts+1),
+	))
+	defer func() { endSpan(span, err) }()
+	attempt := &db.Attempt{JobID: j.ID, StartTime: time.Now()}
+	action := w.PostAction
+	if j.action != nil {
+		action = j.action
+	}
+	if action != nil {
+		botClient, userClient := w.jobClients(j)
+		msgs, err = action(j.ValueMap, botClient.withContext(ctx), userClient.withContext(ctx))
 	} else {
 		j.Messages = []string{}
 	}
+	j.Attempts++
+	attempt.Number = j.Attempts
+	attempt.Messages = msgs
+	attempt.EndTime = time.Now()
+	metrics.ActionDuration.Observe(attempt.EndTime.Sub(attempt.StartTime).Seconds())
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	if dberr := w.db.InsertAttempt(attempt); dberr != nil {
+		joblog.Error("Error inserting attempt into db", "attempt", attempt.Number, "error", dberr)
+	}
 	j.Messages = msgs
+
+	if IsRetryable(err) && j.Attempts < w.retry.MaxAttempts {
+		delay := w.retry.Backoff(j.Attempts)
+		joblog.Warn("Job failed with retryable error", "attempt", j.Attempts, "max_attempts", w.retry.MaxAttempts, "retry_in", delay, "error", err)
+		metrics.JobRetries.Inc()
+		go w.requeue(j, delay)
+		return
+	}
+
 	j.EndTime = time.Now()
+	w.finished(j.UserID)
+	state := metrics.StateSucceeded
 	if err == nil {
-		w.log.Printf("Job [J%d] %s finished", j.ID, j.Label)
+		joblog.Info("Job finished")
 	} else {
-		w.log.Printf("Job [J%d]  %s failed: %s", j.ID, j.Label, err)
+		joblog.Error("Job failed", "error", err)
 		j.Error = err.Error()
+		state = metrics.StateFailed
+	}
+	metrics.JobsFinished.WithLabelValues(state).Inc()
+	metrics.JobDuration.WithLabelValues(state).Observe(j.EndTime.Sub(j.SubmitTime).Seconds())
+}
+
+// jobClients returns the bot client and the user client of the job, which
+// record their changes in the audit log with the user and ID of the job.
+func (w *Worker) jobClients(j *UserJob) (botClient, userClient *Client) {
+	return w.client.Audit(w.db, AuditBot, j.UserID, j.ID), j.client.Audit(w.db, AuditUser, j.UserID, j.ID)
+}
+
+// notify calls the given notifiers for the finished job.
+func (w *Worker) notify(j *UserJob, notifiers []Notifier) {
+	j.Lock()
+	defer j.Unlock()
+	botClient, userClient := w.jobClients(j)
+	for _, n := range notifiers {
+		if err := n.Notify(j.Job, botClient, userClient); err != nil {
+			w.log.Error("Failed to send notification", "job", j.ID, "user", j.UserID, "error", err)
+		}
+	}
+}
+
+// requeue adds the job back to the queue after the given delay, unless the
+// worker is stopped in the meantime.
+func (w *Worker) requeue(j *UserJob, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		select {
+		case w.queue <- j:
+			metrics.QueueDepth.Set(float64(len(w.queue)))
+		case <-w.stop:
+		}
+	case <-w.stop:
 	}
 }
 
 // Start the worker queue, reading jobs sequentially from the channel and
 // executing their custom function.
 func (w *Worker) Start() {
+	w.running.Store(true)
 	go func() {
+		defer w.running.Store(false)
 		for {
 			select {
 			case job := <-w.queue:
+				metrics.QueueDepth.Set(float64(len(w.queue)))
 				w.run(job)
+				if notifiers := w.getNotifiers(); job.IsFinished() && len(notifiers) > 0 {
+					go w.notify(job, notifiers)
+				}
 			case <-w.stop:
 				return
 			}
@@ -1,15 +1,24 @@
 package worker
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/G-Node/tonic/tonic/db"
+	"github.com/gogs/go-gogs-client"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func TestWorkerEmptyJob(t *testing.T) {
@@ -25,7 +34,7 @@ func TestWorkerEmptyJob(t *testing.T) {
 	}
 	defer conn.Close()
 
-	w := New(conn)
+	w := New(conn, 0)
 	w.PostAction = testAction
 	w.Start()
 	defer w.Stop()
@@ -55,7 +64,7 @@ func TestWorkerAction(t *testing.T) {
 	}
 	defer conn.Close()
 
-	w := New(conn)
+	w := New(conn, 0)
 	w.PostAction = testAction
 	w.Start()
 	defer w.Stop()
@@ -87,7 +96,7 @@ func TestWorkerJobFail(t *testing.T) {
 	}
 	defer conn.Close()
 
-	w := New(conn)
+	w := New(conn, 0)
 	w.PostAction = testAction
 	w.Start()
 	defer w.Stop()
@@ -121,3 +130,426 @@ func testAction(values map[string][]string, bc, uc *Client) ([]string, error) {
 
 	return m, err
 }
+
+func TestWorkerRetry(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	conn, err := db.New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer conn.Close()
+
+	// fail with a retryable error until the values contain the run count
+	runs := 0
+	flakyAction := func(values map[string][]string, bc, uc *Client) ([]string, error) {
+		runs++
+		msgs := []string{fmt.Sprintf("run %d", runs)}
+		if values["succeed-on"][0] != fmt.Sprint(runs) {
+			return msgs, Retryable(fmt.Errorf("transient failure %d", runs))
+		}
+		return msgs, nil
+	}
+
+	w := New(conn, 0)
+	w.PostAction = flakyAction
+	w.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond})
+	w.Start()
+	defer w.Stop()
+
+	j := &UserJob{Job: &db.Job{ValueMap: map[string][]string{"succeed-on": {"3"}}}, client: new(Client)}
+	w.Enqueue(j)
+	for start := time.Now(); !j.IsFinished() && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	if !j.IsFinished() {
+		t.Fatalf("Job not finished: %+v", j)
+	}
+	j.Lock()
+	if j.Error != "" {
+		t.Fatalf("Job failed with error: %s", j.Error)
+	}
+	if j.Attempts != 3 {
+		t.Fatalf("Unexpected number of attempts: %d != 3", j.Attempts)
+	}
+	j.Unlock()
+
+	attempts, err := conn.GetJobAttempts(j.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve job attempts: %s", err.Error())
+	}
+	if len(attempts) != 3 {
+		t.Fatalf("Unexpected number of recorded attempts: %d != 3", len(attempts))
+	}
+	for idx, attempt := range attempts {
+		if attempt.Number != idx+1 {
+			t.Fatalf("Unexpected attempt number: %d != %d", attempt.Number, idx+1)
+		}
+		if idx < 2 && attempt.Error == "" {
+			t.Fatalf("Attempt %d should have recorded an error", attempt.Number)
+		}
+		if idx == 2 && attempt.Error != "" {
+			t.Fatalf("Attempt %d failed with error: %s", attempt.Number, attempt.Error)
+		}
+	}
+
+	// give up after MaxAttempts
+	runs = 0
+	j = &UserJob{Job: &db.Job{ValueMap: map[string][]string{"succeed-on": {"5"}}}, client: new(Client)}
+	w.Enqueue(j)
+	for start := time.Now(); !j.IsFinished() && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	if !j.IsFinished() {
+		t.Fatalf("Job not finished: %+v", j)
+	}
+	j.Lock()
+	defer j.Unlock()
+	if j.Error != "transient failure 3" {
+		t.Fatalf("Unexpected job error: %q", j.Error)
+	}
+	if j.Attempts != 3 {
+		t.Fatalf("Unexpected number of attempts: %d != 3", j.Attempts)
+	}
+}
+
+func TestWorkerNoRetry(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	conn, err := db.New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer conn.Close()
+
+	// non-retryable errors are final regardless of the policy
+	w := New(conn, 0)
+	w.PostAction = testAction
+	w.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond})
+	w.Start()
+	defer w.Stop()
+	j := &UserJob{Job: &db.Job{ValueMap: map[string][]string{"A": {"error"}}}, client: new(Client)}
+	w.Enqueue(j)
+	time.Sleep(10 * time.Millisecond)
+	if !j.IsFinished() {
+		t.Fatalf("Job not finished: %+v", j)
+	}
+	if j.Attempts != 1 {
+		t.Fatalf("Unexpected number of attempts: %d != 1", j.Attempts)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, Delay: time.Second, MaxDelay: 10 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for idx, exp := range expected {
+		if delay := p.Backoff(idx + 1); delay != exp {
+			t.Fatalf("Unexpected backoff delay after %d attempts: %s != %s", idx+1, delay, exp)
+		}
+	}
+	// without MaxDelay, the delay is bounded and doesn't overflow
+	p = RetryPolicy{MaxAttempts: 100, Delay: time.Second}
+	for attempts := 1; attempts <= 100; attempts++ {
+		if delay := p.Backoff(attempts); delay <= 0 || delay > defaultMaxRetryDelay {
+			t.Fatalf("Unexpected backoff delay without MaxDelay after %d attempts: %s", attempts, delay)
+		}
+	}
+	if delay := p.Backoff(100); delay != defaultMaxRetryDelay {
+		t.Fatalf("Unexpected backoff delay without MaxDelay: %s != %s", delay, defaultMaxRetryDelay)
+	}
+
+	if !IsRetryable(fmt.Errorf("wrapped: %w", Retryable(fmt.Errorf("network error")))) {
+		t.Fatal("Wrapped retryable error not detected")
+	}
+	if IsRetryable(fmt.Errorf("network error")) {
+		t.Fatal("Plain error detected as retryable")
+	}
+	if Retryable(nil) != nil {
+		t.Fatal("Retryable(nil) should be nil")
+	}
+}
+
+func TestWorkerQueueLimits(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	conn, err := db.New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer conn.Close()
+
+	// worker is not started so jobs stay in the queue
+	w := New(conn, 3)
+	w.SetMaxUserJobs(2)
+	w.PostAction = testAction
+	newJob := func(uid int64) *UserJob {
+		return &UserJob{Job: &db.Job{UserID: uid}, client: new(Client)}
+	}
+
+	if err := w.Enqueue(newJob(1)); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if err := w.Enqueue(newJob(1)); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if err := w.Enqueue(newJob(1)); err != ErrUserLimit {
+		t.Fatalf("Unexpected error for job over the user limit: %v", err)
+	}
+	if err := w.Enqueue(newJob(2)); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	if err := w.Enqueue(newJob(3)); err != ErrQueueFull {
+		t.Fatalf("Unexpected error for job over the queue capacity: %v", err)
+	}
+
+	if jobs, err := conn.GetAllJobs(); err != nil {
+		t.Fatalf("Failed to retrieve jobs: %v", err)
+	} else if len(jobs) != 3 {
+		t.Fatalf("Rejected jobs were stored: %d jobs in db (expected 3)", len(jobs))
+	}
+
+	// finishing jobs frees up the user's slots
+	w.Start()
+	defer w.Stop()
+	unfinished := func(uid int64) int {
+		w.queueLock.Lock()
+		defer w.queueLock.Unlock()
+		return w.userJobs[uid]
+	}
+	for start := time.Now(); unfinished(1) > 0 && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	if err := w.Enqueue(newJob(1)); err != nil {
+		t.Fatalf("Failed to enqueue job after previous jobs finished: %v", err)
+	}
+}
+
+type chanNotifier chan int64
+
+func (n chanNotifier) Notify(job *db.Job, _, _ *Client) error {
+	n <- job.ID
+	return nil
+}
+
+func TestWorkerNotify(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	conn, err := db.New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer conn.Close()
+
+	notified := make(chanNotifier, 10)
+	w := New(conn, 0)
+	w.PostAction = testAction
+	w.AddNotifier(notified)
+	w.Start()
+	defer w.Stop()
+
+	j := &UserJob{Job: &db.Job{ValueMap: map[string][]string{"A": {"error"}}}, client: new(Client)}
+	w.Enqueue(j)
+	select {
+	case id := <-notified:
+		if id != j.ID {
+			t.Fatalf("Notified for unexpected job: %d != %d", id, j.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Notifier was not called for finished job")
+	}
+}
+
+func TestWorkerTracing(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	conn, err := db.New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer conn.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	actionCtx := make(chan context.Context, 1)
+	w := New(conn, 0)
+	w.PostAction = func(values map[string][]string, bc, uc *Client) ([]string, error) {
+		actionCtx <- uc.ctx
+		return nil, nil
+	}
+	w.Start()
+	defer w.Stop()
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+	j := &UserJob{Job: &db.Job{ValueMap: map[string][]string{}}, client: new(Client)}
+	if err := w.EnqueueContext(ctx, j); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	request.End()
+
+	var jobCtx context.Context
+	select {
+	case jobCtx = <-actionCtx:
+	case <-time.After(time.Second):
+		t.Fatal("Job did not run")
+	}
+
+	traceID := request.SpanContext().TraceID()
+	if j.TraceID != traceID.String() {
+		t.Fatalf("Job trace ID %q does not match request trace %q", j.TraceID, traceID)
+	}
+	stored, err := conn.GetJob(j.ID)
+	if err != nil {
+		t.Fatalf("Failed to read job from db: %v", err)
+	}
+	if stored.TraceID != j.TraceID || stored.SpanID != j.SpanID {
+		t.Fatalf("Stored trace IDs %q/%q do not match %q/%q", stored.TraceID, stored.SpanID, j.TraceID, j.SpanID)
+	}
+	if sc := trace.SpanContextFromContext(jobCtx); sc.TraceID() != traceID {
+		t.Fatalf("Client context is not part of the request trace: %q != %q", sc.TraceID(), traceID)
+	}
+
+	// wait for the job span to end
+	time.Sleep(10 * time.Millisecond)
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	enqueue, ok := spans["enqueue"]
+	if !ok {
+		t.Fatal("No enqueue span recorded")
+	}
+	if enqueue.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Fatal("Enqueue span is not a child of the request span")
+	}
+	jobSpan, ok := spans["job"]
+	if !ok {
+		t.Fatal("No job span recorded")
+	}
+	if jobSpan.Parent().SpanID() != enqueue.SpanContext().SpanID() || jobSpan.SpanContext().TraceID() != traceID {
+		t.Fatal("Job span is not a child of the enqueue span")
+	}
+}
+
+func TestWorkerAudit(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testdb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary database file: %s", err.Error())
+	}
+	defer os.Remove(tmpfile.Name())
+
+	conn, err := db.New(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to initialise database connection to file %q: %s", tmpfile.Name(), err.Error())
+	}
+	defer conn.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"name": "data"}`)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "bot is not allowed to delete repository"}`)
+		default:
+			fmt.Fprint(w, `{"name": "data"}`)
+		}
+	}))
+	defer ts.Close()
+
+	w := New(conn, 0)
+	w.PostAction = func(values map[string][]string, bc, uc *Client) ([]string, error) {
+		if _, err := uc.CreateRepo(gogs.CreateRepoOption{Name: "data"}); err != nil {
+			return nil, err
+		}
+		if _, err := uc.GetRepo("alice", "data"); err != nil {
+			return nil, err
+		}
+		if err := bc.DeleteRepo("alice", "data"); err == nil {
+			return nil, fmt.Errorf("deleting repository succeeded when it should have failed")
+		}
+		return nil, nil
+	}
+	w.Start()
+	defer w.Stop()
+	w.client = NewClient(ts.URL, "git@example.org", "testadmintoken")
+	j := NewUserJob(NewClient(ts.URL, "git@example.org", "testusertoken"), "audittest", map[string][]string{})
+	j.UserID = 7
+	if err := w.Enqueue(j); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !j.IsFinished() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !j.IsFinished() || j.Error != "" {
+		t.Fatalf("Job did not finish successfully: %q", j.Error)
+	}
+
+	entries, err := conn.GetAuditEntries(10)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	// GET requests are not recorded; newest first
+	if len(entries) != 2 {
+		t.Fatalf("Unexpected number of audit entries: %d != 2", len(entries))
+	}
+	deleted, created := entries[0], entries[1]
+	if created.Actor != AuditUser || created.Method != http.MethodPost || created.Endpoint != "/api/v1/user/repos" || created.Status != http.StatusCreated || !created.Succeeded() {
+		t.Errorf("Unexpected audit entry for created repository: %+v", created)
+	}
+	if deleted.Actor != AuditBot || deleted.Method != http.MethodDelete || deleted.Endpoint != "/api/v1/repos/alice/data" || deleted.Status != http.StatusForbidden || deleted.Succeeded() {
+		t.Errorf("Unexpected audit entry for deleted repository: %+v", deleted)
+	}
+	if deleted.Error != "bot is not allowed to delete repository" {
+		t.Errorf("Audit entry does not record error message: %q", deleted.Error)
+	}
+	for _, entry := range entries {
+		if entry.UserID != 7 || entry.JobID != j.ID {
+			t.Errorf("Audit entry not attributed to job %d of user 7: %+v", j.ID, entry)
+		}
+	}
+
+	// clients that are not audited record nothing
+	if _, err := NewClient(ts.URL, "git@example.org", "testusertoken").CreateRepo(gogs.CreateRepoOption{Name: "other"}); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if entries, _ := conn.GetAuditEntries(10); len(entries) != 2 {
+		t.Fatalf("Unaudited client recorded change: %d entries", len(entries))
+	}
+
+	// changes made by the gin-cli client are recorded explicitly
+	bc := w.client.Audit(conn, AuditBot, 7, j.ID)
+	bc.audit.record(http.MethodPost, "/api/v1/user/keys", http.StatusCreated, fmt.Errorf("key rejected"))
+	if entries, _ := conn.GetAuditEntries(1); len(entries) != 1 || entries[0].Endpoint != "/api/v1/user/keys" || entries[0].Error != "key rejected" || entries[0].Succeeded() {
+		t.Errorf("Unexpected audit entry for session key: %+v", entries)
+	}
+	NewClient(ts.URL, "git@example.org", "testusertoken").audit.record(http.MethodPost, "/api/v1/user/keys", http.StatusCreated, nil)
+	if entries, _ := conn.GetAuditEntries(10); len(entries) != 3 {
+		t.Fatalf("Unaudited client recorded session key: %d entries", len(entries))
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,6 +9,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 
 	"github.com/G-Node/gin-cli/ginclient"
 	"github.com/G-Node/gin-cli/git"
@@ -26,8 +26,9 @@ type labProjectConfig struct {
 	TemplateRepo string
 }
 
-// lbconfig global configuration for tonic
-var lpconfig *labProjectConfig
+// lpconfig global configuration for tonic; replaced when the service is
+// reloaded
+var lpconfig atomic.Pointer[labProjectConfig]
 
 func main() {
 	elems := []form.Element{
@@ -72,11 +73,29 @@ func main() {
 		Name:        "module addition",
 		Description: "",
 	}
-	lpconfig = readConfig("labproject.json")
-	tsrv, err := tonic.NewService(lpform, setForm, newProject, *lpconfig.Config)
+	config, err := readConfig("labproject.json")
 	if err != nil {
 		log.Fatal(err)
 	}
+	lpconfig.Store(config)
+	tsrv, err := tonic.NewService(lpform, setForm, newProject, *config.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// re-read the configuration file on SIGHUP; the service settings are
+	// only replaced if tonic accepts the new configuration
+	var reloaded *labProjectConfig
+	tsrv.SetReloader(func() (tonic.Config, form.Form, error) {
+		config, err := readConfig("labproject.json")
+		if err != nil {
+			return tonic.Config{}, form.Form{}, err
+		}
+		reloaded = config
+		return *config.Config, lpform, nil
+	})
+	tsrv.OnReload(func() {
+		lpconfig.Store(reloaded)
+	})
 	err = tsrv.Start()
 	if err != nil {
 		log.Fatal(err)
@@ -108,6 +127,7 @@ func setForm(f form.Form, botClient, userClient *worker.Client) (*form.Form, err
 }
 
 func newProject(values map[string][]string, botClient, userClient *worker.Client) ([]string, error) {
+	templateRepo := lpconfig.Load().TemplateRepo
 	orgName := values["organisation"][0] // required
 	project := values["project"][0]      // required
 	title := ""
@@ -160,14 +180,14 @@ func newProject(values map[string][]string, botClient, userClient *worker.Client
 	}
 
 	// Clone repository
-	msgs = append(msgs, fmt.Sprintf("Cloning template repository %s", lpconfig.TemplateRepo))
-	if err := botClient.CloneRepo(lpconfig.TemplateRepo, tempDirName); err != nil {
-		msgs = append(msgs, fmt.Sprintf("Failed to clone repository %q: %v", lpconfig.TemplateRepo, err.Error()))
+	msgs = append(msgs, fmt.Sprintf("Cloning template repository %s", templateRepo))
+	if err := botClient.CloneRepo(templateRepo, tempDirName); err != nil {
+		msgs = append(msgs, fmt.Sprintf("Failed to clone repository %q: %v", templateRepo, err.Error()))
 		return msgs, err
 	}
 
 	// CD into new clone
-	repoName := strings.Split(lpconfig.TemplateRepo, "/")[1]
+	repoName := strings.Split(templateRepo, "/")[1]
 	localRepoPath := filepath.Join(tempDirName, repoName)
 	origdir, err := os.Getwd()
 	if err != nil {
@@ -415,60 +435,26 @@ func getAvailableOrgsAndTeams(botClient, userClient *worker.Client) (map[string]
 	return validOrgTeams, nil
 }
 
-func readConfig(filename string) *labProjectConfig {
-	confFile, err := os.Open(filename)
-	if err != nil {
-		log.Fatal(err)
-	}
-	confData, err := ioutil.ReadAll(confFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	config := new(labProjectConfig)
-	if err := json.Unmarshal(confData, config); err != nil {
-		log.Fatal(err)
-	}
-
-	if config.Config == nil {
-		config.Config = new(tonic.Config)
-	}
-
-	// Set defaults for any unset values
-	if config.CookieName == "" {
-		config.CookieName = "utonic-labproject"
-		log.Printf("[config] Setting default cookie name: %s", config.CookieName)
-	}
-	if config.Port == 0 {
-		config.Port = 3000
-		log.Printf("[config] Setting default port: %d", config.Port)
-	}
-	if config.DBPath == "" {
-		config.DBPath = "./labproject.db"
-		log.Printf("[config] Setting default dbpath: %s", config.DBPath)
+func readConfig(filename string) (*labProjectConfig, error) {
+	// Defaults for optional values
+	config := &labProjectConfig{
+		Config: &tonic.Config{
+			Name:       "add_module",
+			CookieName: "utonic-labproject",
+			Port:       3000,
+			DBPath:     "./labproject.db",
+		},
 	}
 
-	// Warn about unset values with no defaults
-	unset := make([]string, 0, 5)
-	if config.GIN.Web == "" {
-		unset = append(unset, "gin.web")
-	}
-	if config.GIN.Git == "" {
-		unset = append(unset, "gin.git")
-	}
-	if config.GIN.Username == "" {
-		unset = append(unset, "gin.username")
+	loader := tonic.ConfigLoader{
+		File:     filename,
+		Args:     os.Args[1:],
+		Required: []string{"gin.web", "gin.git", "templaterepo"},
 	}
-	if config.GIN.Password == "" {
-		unset = append(unset, "gin.password")
-	}
-	if config.TemplateRepo == "" {
-		unset = append(unset, "templaterepo")
-	}
-	if len(unset) > 0 {
-		log.Printf("WARNING: The following configuration options are unset and have no defaults: %s", strings.Join(unset, ", "))
+	if err := loader.Load(config); err != nil {
+		return nil, err
 	}
-	return config
+	return config, nil
 }
 
 func commit(botClient *worker.Client, msg string) error {
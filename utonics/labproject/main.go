@@ -2,18 +2,20 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 
 	"github.com/G-Node/gin-cli/ginclient"
 	"github.com/G-Node/gin-cli/git"
 	"github.com/G-Node/tonic/tonic"
+	"github.com/G-Node/tonic/tonic/db"
 	"github.com/G-Node/tonic/tonic/form"
 	"github.com/G-Node/tonic/tonic/worker"
 	"github.com/gogs/go-gogs-client"
@@ -26,8 +28,9 @@ type labProjectConfig struct {
 	TemplateRepo string
 }
 
-// lbconfig global configuration for tonic
-var lpconfig *labProjectConfig
+// lpconfig global configuration for tonic; replaced when the service is
+// reloaded
+var lpconfig atomic.Pointer[labProjectConfig]
 
 func main() {
 	elems := []form.Element{
@@ -72,11 +75,36 @@ func main() {
 		Name:        "Project creation",
 		Description: "",
 	}
-	lpconfig = readConfig("labproject.json")
-	tsrv, err := tonic.NewService(lpform, setForm, newProject, *lpconfig.Config)
+	config, err := readConfig("labproject.json")
 	if err != nil {
 		log.Fatal(err)
 	}
+	lpconfig.Store(config)
+	tsrv, err := tonic.NewService(lpform, setForm, newProject, *config.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// re-read the configuration file on SIGHUP; the service settings are
+	// only replaced if tonic accepts the new configuration
+	var reloaded *labProjectConfig
+	tsrv.SetReloader(func() (tonic.Config, form.Form, error) {
+		config, err := readConfig("labproject.json")
+		if err != nil {
+			return tonic.Config{}, form.Form{}, err
+		}
+		reloaded = config
+		return *config.Config, lpform, nil
+	})
+	tsrv.OnReload(func() {
+		lpconfig.Store(reloaded)
+	})
+	// page listing the projects of the user's lab organisations
+	if err := tsrv.AddPage("Projects", projectsTemplate); err != nil {
+		log.Fatal(err)
+	}
+	if err := tsrv.HandlePage("/projects", tonic.Authenticated, "Projects", listProjects); err != nil {
+		log.Fatal(err)
+	}
 	err = tsrv.Start()
 	if err != nil {
 		log.Fatal(err)
@@ -107,7 +135,53 @@ func setForm(f form.Form, botClient, userClient *worker.Client) (*form.Form, err
 	return &f, nil
 }
 
+// projectsTemplate lists the repositories of each lab organisation.
+const projectsTemplate = `
+{{define "content"}}
+	<div class="repository file list">
+		<div class="ui container">
+			<p id="repo-desc">
+			<span class="description has-emoji">{{T "Projects"}}</span>
+			</p>
+			{{range $org, $repos := .}}
+			<h4 class="ui header">{{$org}}</h4>
+			<table class="ui unstackable fixed single line table">
+				<tbody>
+					{{range $repos}}
+					<tr><td><a href="{{.HTMLURL}}">{{.FullName}}</a></td></tr>
+					{{else}}
+					<tr><td>{{T "No projects"}}</td></tr>
+					{{end}}
+				</tbody>
+			</table>
+			{{else}}
+			<p>{{T "You are not a member of any lab organisation"}}</p>
+			{{end}}
+		</div>
+	</div>
+{{end}}
+`
+
+// listProjects returns the repositories the user can access in each of the
+// organisations available on the service for the Projects page.
+func listProjects(r *http.Request, sess *db.Session, botClient, userClient *worker.Client) (interface{}, error) {
+	orgs, err := getAvailableOrgsAndTeams(botClient, userClient)
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string][]*gogs.Repository, len(orgs))
+	for org := range orgs {
+		repos, err := userClient.ListOrgRepos(org)
+		if err != nil {
+			return nil, err
+		}
+		projects[org] = repos
+	}
+	return projects, nil
+}
+
 func newProject(values map[string][]string, botClient, userClient *worker.Client) ([]string, error) {
+	templateRepo := lpconfig.Load().TemplateRepo
 	orgName := values["organisation"][0] // required
 	project := values["project"][0]      // required
 	title := ""
@@ -130,7 +204,7 @@ func newProject(values map[string][]string, botClient, userClient *worker.Client
 	validOrgs, err := getAvailableOrgsAndTeams(botClient, userClient)
 	if err != nil {
 		msgs = append(msgs, "Failed to get list of valid orgs")
-		return msgs, err
+		return msgs, worker.Retryable(err)
 	}
 	for validOrg := range validOrgs {
 		if validOrg == orgName {
@@ -149,7 +223,7 @@ func newProject(values map[string][]string, botClient, userClient *worker.Client
 	// Initialise GIN Client to clone and push repository
 	if err := botClient.InitGINClient(); err != nil {
 		msgs = append(msgs, fmt.Sprintf("Failed to initialise GIN Client: %v", err.Error()))
-		return msgs, err
+		return msgs, worker.Retryable(err)
 	}
 
 	// Create temporary directory for cloning
@@ -160,14 +234,14 @@ func newProject(values map[string][]string, botClient, userClient *worker.Client
 	}
 
 	// Clone repository
-	msgs = append(msgs, fmt.Sprintf("Cloning template repository %s", lpconfig.TemplateRepo))
-	if err := botClient.CloneRepo(lpconfig.TemplateRepo, tempDirName); err != nil {
-		msgs = append(msgs, fmt.Sprintf("Failed to clone repository %q: %v", lpconfig.TemplateRepo, err.Error()))
-		return msgs, err
+	msgs = append(msgs, fmt.Sprintf("Cloning template repository %s", templateRepo))
+	if err := botClient.CloneRepo(templateRepo, tempDirName); err != nil {
+		msgs = append(msgs, fmt.Sprintf("Failed to clone repository %q: %v", templateRepo, err.Error()))
+		return msgs, worker.Retryable(err)
 	}
 
 	// CD into new clone
-	repoName := strings.Split(lpconfig.TemplateRepo, "/")[1]
+	repoName := strings.Split(templateRepo, "/")[1]
 	localRepoPath := filepath.Join(tempDirName, repoName)
 	origdir, err := os.Getwd()
 	if err != nil {
@@ -476,60 +550,26 @@ func getAvailableOrgsAndTeams(botClient, userClient *worker.Client) (map[string]
 	return validOrgTeams, nil
 }
 
-func readConfig(filename string) *labProjectConfig {
-	confFile, err := os.Open(filename)
-	if err != nil {
-		log.Fatal(err)
-	}
-	confData, err := ioutil.ReadAll(confFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	config := new(labProjectConfig)
-	if err := json.Unmarshal(confData, config); err != nil {
-		log.Fatal(err)
-	}
-
-	if config.Config == nil {
-		config.Config = new(tonic.Config)
-	}
-
-	// Set defaults for any unset values
-	if config.CookieName == "" {
-		config.CookieName = "utonic-labproject"
-		log.Printf("[config] Setting default cookie name: %s", config.CookieName)
-	}
-	if config.Port == 0 {
-		config.Port = 3000
-		log.Printf("[config] Setting default port: %d", config.Port)
-	}
-	if config.DBPath == "" {
-		config.DBPath = "./labproject.db"
-		log.Printf("[config] Setting default dbpath: %s", config.DBPath)
+func readConfig(filename string) (*labProjectConfig, error) {
+	// Defaults for optional values
+	config := &labProjectConfig{
+		Config: &tonic.Config{
+			Name:       "labproject",
+			CookieName: "utonic-labproject",
+			Port:       3000,
+			DBPath:     "./labproject.db",
+		},
 	}
 
-	// Warn about unset values with no defaults
-	unset := make([]string, 0, 5)
-	if config.GIN.Web == "" {
-		unset = append(unset, "gin.web")
+	loader := tonic.ConfigLoader{
+		File:     filename,
+		Args:     os.Args[1:],
+		Required: []string{"gin.web", "gin.git", "templaterepo"},
 	}
-	if config.GIN.Git == "" {
-		unset = append(unset, "gin.git")
-	}
-	if config.GIN.Username == "" {
-		unset = append(unset, "gin.username")
-	}
-	if config.GIN.Password == "" {
-		unset = append(unset, "gin.password")
-	}
-	if config.TemplateRepo == "" {
-		unset = append(unset, "templaterepo")
-	}
-	if len(unset) > 0 {
-		log.Printf("WARNING: The following configuration options are unset and have no defaults: %s", strings.Join(unset, ", "))
+	if err := loader.Load(config); err != nil {
+		return nil, err
 	}
-	return config
+	return config, nil
 }
 
 